@@ -2,13 +2,14 @@ package abios
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	. "github.com/PatronGG/abios-go-sdk/structs"
 	"github.com/gobuffalo/uuid"
-	"github.com/gorilla/websocket"
 )
 
 // Constant variables that represents endpoints
@@ -43,8 +44,11 @@ const (
 )
 
 // AbiosSdk defines the interface of an implementation of a SDK targeting the Abios endpoints.
+// It only holds the API calls, the client returned by New is configured through the
+// options given to New.
 type AbiosSdk interface {
 	SetRate(second, minute int)
+	WithContext(ctx context.Context) AbiosSdk
 	Games(params Parameters) (GameStructPaginated, *ErrorStruct)
 	Series(params Parameters) (SeriesStructPaginated, *ErrorStruct)
 	SeriesById(id int, params Parameters) (SeriesStruct, *ErrorStruct)
@@ -61,34 +65,70 @@ type AbiosSdk interface {
 	Incidents(params Parameters) (IncidentStructPaginated, *ErrorStruct)
 	IncidentsBySeriesId(id int) (SeriesIncidentsStruct, *ErrorStruct)
 	Organisations(params Parameters) (OrganisationStructPaginated, *ErrorStruct)
-	OrganisationsById(id int, params Parameters) (OrganisationStructPaginated, *ErrorStruct)
+	OrganisationsById(id int, params Parameters) (OrganisationStruct, *ErrorStruct)
+	TeamsByIds(ctx context.Context, ids []int64, params Parameters) map[int64]BatchResult[TeamStruct]
+	PlayersByIds(ctx context.Context, ids []int64, params Parameters) map[int64]BatchResult[PlayerStruct]
+	SeriesByIds(ctx context.Context, ids []int64, params Parameters) map[int64]BatchResult[SeriesStruct]
 
 	// PUSH API
 	CreateSubscription(sub Subscription) (uuid.UUID, error)
 	ListSubscriptions() ([]Subscription, error)
-	// UpdateSubscription(id int, sub Subscription) (Subscription, error)
-	// DeleteSubscription(id int) error
+	UpdateSubscription(id uuid.UUID, sub Subscription) (Subscription, error)
+	DeleteSubscription(id uuid.UUID) error
+	EnsureSubscription(ctx context.Context, desired Subscription) (Subscription, error)
+	PruneSubscriptions(keep func(Subscription) bool) ([]Subscription, error)
 	// PushServiceConfig() ([]byte, error)
-	PushServiceConnect() error
+	PushServiceConnect(subscriptionID uuid.UUID) error
 }
 
+var _ AbiosSdk = (*client)(nil)
+
 // client holds the oauth string returned from Authenticate as well as this sessions
-// requestHandler.
+// requestHandler. Copies made by WithContext share everything but the context.
 type client struct {
-	username       string
-	password       string
-	oauth          AccessTokenStruct
-	handler        *requestHandler
-	wsConn         *websocket.Conn
-	reconnectToken uuid.UUID
+	ctx      context.Context
+	username string
+	password string
+	oauth    *accessToken
+	handler  *requestHandler
+	push     *pushState
+	latency  *latencyTracker
+}
+
+// accessToken holds the oauth token, which the authenticator replaces while requests
+// read it.
+type accessToken struct {
+	mu    sync.RWMutex
+	token AccessTokenStruct
+}
+
+// get returns the current token.
+func (t *accessToken) get() AccessTokenStruct {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.token
+}
+
+// set replaces the token.
+func (t *accessToken) set(token AccessTokenStruct) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = token
 }
 
 // authenticator makes sure the oauth token doesn't expire.
 func (a *client) authenticator() {
 	for {
 		// Wait until token is about to expire
-		expires := time.Duration(a.oauth.ExpiresIn) * time.Second
-		time.Sleep(expires - time.Minute*9) // Sleep until at most 9 minutes left.
+		expires := time.Duration(a.oauth.get().ExpiresIn) * time.Second
+		wait := expires - time.Minute*9 // Sleep until at most 9 minutes left.
+		if wait < expires/2 {
+			wait = expires / 2 // Short-lived tokens, e.g. from a test server.
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+		time.Sleep(wait)
 
 		err := a.authenticate() // try once
 		if err == nil {
@@ -102,32 +142,38 @@ func (a *client) authenticator() {
 
 		select {
 		case <-retry.C:
+			a.handler.getMetrics().Add(metricRetries, 1, Labels{"operation": "authenticate"})
 			err = a.authenticate()
 			if err == nil {
-				a.handler.override = responseOverride{override: false, data: result{}}
+				a.handler.setOverride(responseOverride{override: false, data: result{}})
 				break
 			}
 		case <-fail.C:
-			a.handler.override = responseOverride{override: true, data: *err}
+			a.handler.setOverride(responseOverride{override: true, data: *err})
 			break
 		}
 	}
 }
 
 // NewAbios returns a new endpoint-wrapper for api version 2 with given credentials.
-func New(username, password string) *client {
+// The options are applied before authenticating.
+func New(username, password string, opts ...Option) *client {
 	r := newRequestHandler()
 	c := &client{
-		username:       username,
-		password:       password,
-		oauth:          AccessTokenStruct{},
-		handler:        r,
-		wsConn:         nil,
-		reconnectToken: uuid.Nil,
+		username: username,
+		password: password,
+		ctx:      context.Background(),
+		oauth:    &accessToken{},
+		handler:  r,
+		push:     newPushState(),
+		latency:  newLatencyTracker(),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 	err := c.authenticate()
 	if err != nil {
-		c.handler.override = responseOverride{override: true, data: *err}
+		c.handler.setOverride(responseOverride{override: true, data: *err})
 	}
 	go c.authenticator() // Launch authenticator
 	return c
@@ -140,22 +186,75 @@ func (a *client) SetRate(second, minute int) {
 	a.handler.setRate(second, minute)
 }
 
+// WithContext returns a view of the client whose requests are performed with ctx. The
+// view shares token, rate limits and queue with the original. Use WithPriority to make
+// requests wait in a different lane of the queue.
+func (a *client) WithContext(ctx context.Context) AbiosSdk {
+	return a.withContext(ctx)
+}
+
+// withContext returns the view of the client WithContext returns. A nil ctx means
+// context.Background.
+func (a *client) withContext(ctx context.Context) *client {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	view := *a
+	view.ctx = ctx
+	return &view
+}
+
+// QueueDepth returns the number of requests waiting in each lane of the queue.
+func (a *client) QueueDepth() map[Priority]int {
+	return a.handler.queueDepth()
+}
+
+// SetQueueCapacity sets how many requests can wait in the queue. A value less than or
+// equal to 0 means the previous value is kept. Default value is 300.
+func (a *client) SetQueueCapacity(capacity int) {
+	a.handler.setQueueCapacity(capacity)
+}
+
+// SetOverflowPolicy sets what happens to a new request when the queue is full. Default
+// is OverflowBlock.
+func (a *client) SetOverflowPolicy(policy OverflowPolicy) {
+	a.handler.setOverflowPolicy(policy)
+}
+
+// EstimateWait estimates how long a request with priority p would wait in the queue if
+// it was made now, e.g. to decide whether to serve stale data instead.
+func (a *client) EstimateWait(p Priority) time.Duration {
+	return a.handler.estimateWait(p)
+}
+
+// Rate returns the outgoing rate as set by SetRate.
+func (a *client) Rate() (second, minute int) {
+	return a.handler.rate()
+}
+
 // authenticate queries the /oauth/access_token endpoint with the given credentials and
 // stores the returned oauth token. Return nil if the request was successful.
 func (a *client) authenticate() *result {
 	var payload = []byte(`grant_type=client_credentials&client_id=` + a.username + `&client_secret=` + a.password)
 
-	req, _ := http.NewRequest("POST", access_token, bytes.NewBuffer(payload))
+	req, _ := http.NewRequest("POST", a.handler.pipeline.urls.resolve(access_token), bytes.NewBuffer(payload))
 	req.Header = http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
 
-	statusCode, b := apiCall(req)
-	dec := json.NewDecoder(bytes.NewBuffer(b))
+	res := apiCall(a.handler.pipeline.httpClient(), req)
+	statusCode, b := res.statuscode, res.body
 	if 200 <= statusCode && statusCode < 300 {
 		target := AccessTokenStruct{}
-		dec.Decode(&target)
-		a.oauth = target
+		if err := json.Unmarshal(b, &target); err != nil {
+			a.handler.getMetrics().Add(metricTokenRefreshes, 1, Labels{"result": "error"})
+			res := errorResult("when decoding access token", newDecodeError(req.URL.String(), &target, err))
+			return &res
+		}
+		a.oauth.set(target)
+		a.handler.health.tokenRefreshed(time.Duration(target.ExpiresIn) * time.Second)
+		a.handler.getMetrics().Add(metricTokenRefreshes, 1, Labels{"result": "ok"})
 		return nil
 	} else {
+		a.handler.getMetrics().Add(metricTokenRefreshes, 1, Labels{"result": "error"})
 		return &result{statuscode: statusCode, body: b}
 	}
 
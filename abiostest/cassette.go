@@ -0,0 +1,346 @@
+package abiostest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Interaction is a request to the Abios APIs and its response as stored in a cassette.
+// Credentials are scrubbed before it is stored.
+type Interaction struct {
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	Params      map[string][]string `json:"params,omitempty"` // Normalised, see normalise.
+	RequestBody string              `json:"request_body,omitempty"`
+	Status      int                 `json:"status"`
+	Header      http.Header         `json:"header,omitempty"`
+	Body        string              `json:"body"`
+}
+
+// Cassette is a list of interactions, stored as JSON in a fixture file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads the cassette in the file at path.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	return c, json.Unmarshal(data, c)
+}
+
+// Save writes the cassette to the file at path.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Parameters and fields carrying credentials, scrubbed from cassettes and ignored when
+// matching requests.
+var secrets = []string{"access_token", "reconnect_token", "client_id", "client_secret"}
+
+// Replaces scrubbed values.
+const scrubbed = "REDACTED"
+
+// normalise returns the parameters of a query without credentials, without keys that
+// have no values and with the values of each key sorted, so that equal queries compare
+// equal regardless of how they were built.
+func normalise(query url.Values) map[string][]string {
+	params := make(map[string][]string, len(query))
+	for key, values := range query {
+		if len(values) == 0 || contains(secrets, key) {
+			continue
+		}
+		sorted := append([]string(nil), values...)
+		sort.Strings(sorted)
+		params[key] = sorted
+	}
+	return params
+}
+
+// scrubForm replaces the credentials in a form encoded body.
+func scrubForm(body []byte) string {
+	form, err := url.ParseQuery(string(body))
+	if err != nil || len(form) == 0 {
+		return string(body)
+	}
+	for _, key := range secrets {
+		if _, ok := form[key]; ok {
+			form.Set(key, scrubbed)
+		}
+	}
+	return form.Encode()
+}
+
+// scrubJSON replaces the credentials at the top level of a JSON object, e.g. the token
+// returned by the token endpoint.
+func scrubJSON(body []byte) string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		return string(body)
+	}
+
+	changed := false
+	for _, key := range secrets {
+		if _, ok := object[key]; ok {
+			object[key], _ = json.Marshal(scrubbed)
+			changed = true
+		}
+	}
+	if !changed {
+		return string(body)
+	}
+	data, _ := json.Marshal(object)
+	return string(data)
+}
+
+// Response headers that may carry credentials, dropped from cassettes. Headers whose name
+// contains one of sensitiveHeaderParts are dropped as well.
+var (
+	sensitiveHeaders     = []string{"Set-Cookie", "Cookie", "Authorization", "Proxy-Authorization", "Www-Authenticate"}
+	sensitiveHeaderParts = []string{"Token", "Secret", "Api-Key", "Apikey", "Session"}
+)
+
+// scrubHeader returns a copy of header without the headers that may carry credentials.
+func scrubHeader(header http.Header) http.Header {
+	scrubbedHeader := make(http.Header, len(header))
+	for key, values := range header {
+		canonical := http.CanonicalHeaderKey(key)
+		if contains(sensitiveHeaders, canonical) || containsPart(canonical, sensitiveHeaderParts) {
+			continue
+		}
+		scrubbedHeader[key] = values
+	}
+	return scrubbedHeader
+}
+
+// containsPart reports whether s contains one of parts, ignoring case.
+func containsPart(s string, parts []string) bool {
+	s = strings.ToLower(s)
+	for _, part := range parts {
+		if strings.Contains(s, strings.ToLower(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Recorder is an http.RoundTripper that sends requests through another RoundTripper and
+// records them, with their responses, to a cassette file. Use it as the transport of the
+// client given to abios.WithHTTPClient to capture real responses once:
+//
+//	rec := abiostest.NewRecorder("testdata/series.json", nil)
+//	a := abios.New(id, secret, abios.WithHTTPClient(&http.Client{Transport: rec}))
+type Recorder struct {
+	path      string
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	err      error // The first failure to save the cassette.
+}
+
+// NewRecorder returns a Recorder writing to the file at path and sending requests through
+// transport, or http.DefaultTransport if transport is nil.
+func NewRecorder(path string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{path: path, transport: transport}
+}
+
+// RoundTrip sends req and records it. The cassette file is rewritten after every
+// interaction, so nothing is lost if the test stops early. A failure to write it doesn't
+// fail the request, check Err once the test is done.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The body is read to be stored, so a clone with a copy of it is sent. The caller's
+	// request isn't modified, as the RoundTripper contract requires.
+	var reqBody []byte
+	sent := req
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		sent = req.Clone(req.Context())
+		sent.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(reqBody)), nil
+		}
+		sent.Body, _ = sent.GetBody()
+	}
+
+	resp, err := r.transport.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		Params:      normalise(req.URL.Query()),
+		RequestBody: scrubForm(reqBody),
+		Status:      resp.StatusCode,
+		Header:      scrubHeader(resp.Header),
+		Body:        scrubJSON(body),
+	})
+	if err := r.cassette.Save(r.path); err != nil && r.err == nil {
+		r.err = err
+	}
+	return resp, nil
+}
+
+// Err returns the first error writing the cassette file, or nil if every interaction
+// was saved.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// MatchMode decides which recorded interaction a Replayer serves for a request.
+type MatchMode int
+
+const (
+	// MatchStrict requires the method, path and all parameters to be equal. Each
+	// interaction is served once, in the order they were recorded.
+	MatchStrict MatchMode = iota
+	// MatchLenient requires the method and path to be equal and serves the
+	// interaction with the most parameters in common. Interactions can be served
+	// any number of times.
+	MatchLenient
+)
+
+// Replayer is an http.RoundTripper serving the interactions of a cassette instead of
+// sending requests. Credentials are ignored when matching, so a client replaying a
+// cassette can use any credentials.
+type Replayer struct {
+	mode MatchMode
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// NewReplayer returns a Replayer serving the cassette in the file at path.
+func NewReplayer(path string, mode MatchMode) (*Replayer, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{mode: mode, cassette: c, used: make([]bool, len(c.Interactions))}, nil
+}
+
+// RoundTrip returns the recorded response matching req, or an error if there is none.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	params := normalise(req.URL.Query())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	best, bestScore := -1, -1
+	for i, in := range r.cassette.Interactions {
+		if in.Method != req.Method || in.Path != req.URL.Path {
+			continue
+		}
+		if r.mode == MatchStrict {
+			if r.used[i] || !sameParams(in.Params, params) {
+				continue
+			}
+			best = i
+			break
+		}
+		if score := commonParams(in.Params, params); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best == -1 {
+		return nil, fmt.Errorf("abiostest: no recorded interaction for %s %s", req.Method, req.URL.Path)
+	}
+	r.used[best] = true
+
+	in := r.cassette.Interactions[best]
+	header := http.Header{}
+	for key, values := range in.Header {
+		header[key] = values
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(in.Body))),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Unused returns the interactions that haven't been served, e.g. to check that a test
+// made every request it was recorded with.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unused := []Interaction{}
+	for i, in := range r.cassette.Interactions {
+		if !r.used[i] {
+			unused = append(unused, in)
+		}
+	}
+	return unused
+}
+
+// sameParams reports whether the normalised parameters are equal.
+func sameParams(a, b map[string][]string) bool {
+	return len(a) == len(b) && commonParams(a, b) == len(a)
+}
+
+// commonParams returns the number of keys with equal values in both.
+func commonParams(a, b map[string][]string) int {
+	n := 0
+	for key, values := range a {
+		other, ok := b[key]
+		if !ok || len(other) != len(values) {
+			continue
+		}
+		equal := true
+		for i := range values {
+			if values[i] != other[i] {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			n++
+		}
+	}
+	return n
+}
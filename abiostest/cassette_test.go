@@ -0,0 +1,212 @@
+package abiostest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	tests := []struct {
+		name  string
+		scrub func([]byte) string
+		in    string
+		want  string
+	}{
+		{"form", scrubForm, "client_id=me&client_secret=hunter2&grant_type=client_credentials",
+			"client_id=REDACTED&client_secret=REDACTED&grant_type=client_credentials"},
+		{"form without secrets", scrubForm, "grant_type=client_credentials", "grant_type=client_credentials"},
+		{"not a form", scrubForm, "", ""},
+		{"token", scrubJSON, `{"access_token":"abc","expires_in":3600}`, `{"access_token":"REDACTED","expires_in":3600}`},
+		{"json without secrets", scrubJSON, `{"id":1}`, `{"id":1}`},
+		{"not an object", scrubJSON, `[{"access_token":"abc"}]`, `[{"access_token":"abc"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scrub([]byte(tt.in)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrubHeader(t *testing.T) {
+	header := http.Header{
+		"Content-Type":          {"application/json"},
+		"X-Ratelimit-Remaining": {"4"},
+		"Set-Cookie":            {"session=abc"},
+		"Authorization":         {"Bearer abc"},
+		"X-Access-Token":        {"abc"},
+		"X-Api-Key":             {"abc"},
+	}
+	want := http.Header{
+		"Content-Type":          {"application/json"},
+		"X-Ratelimit-Remaining": {"4"},
+	}
+	if got := scrubHeader(header); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNormalise(t *testing.T) {
+	query := url.Values{
+		"access_token": {"abc"},
+		"games[]":      {"5", "1"},
+		"page":         {"2"},
+		"empty":        {},
+	}
+	want := map[string][]string{"games[]": {"1", "5"}, "page": {"2"}}
+	if got := normalise(query); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReplayerMatching(t *testing.T) {
+	interactions := []Interaction{
+		{Method: "GET", Path: "/v2/series", Params: map[string][]string{"page": {"1"}}, Status: 200, Body: "first"},
+		{Method: "GET", Path: "/v2/series", Params: map[string][]string{"page": {"1"}}, Status: 200, Body: "second"},
+		{Method: "GET", Path: "/v2/series", Params: map[string][]string{"page": {"2"}, "games[]": {"1"}}, Status: 200, Body: "games"},
+		{Method: "GET", Path: "/v2/teams", Status: 404, Body: "teams"},
+	}
+
+	tests := []struct {
+		name     string
+		mode     MatchMode
+		requests []string // Paths with queries.
+		want     []string // Bodies served, "" for no match.
+	}{
+		{"strict in order", MatchStrict,
+			[]string{"/v2/series?page=1&access_token=x", "/v2/series?page=1", "/v2/series?page=1"},
+			[]string{"first", "second", ""}},
+		{"strict needs every parameter", MatchStrict,
+			[]string{"/v2/series?page=2", "/v2/series?games[]=1&page=2"},
+			[]string{"", "games"}},
+		{"lenient most in common", MatchLenient,
+			[]string{"/v2/series?page=2", "/v2/series?games[]=1", "/v2/series?page=1"},
+			[]string{"games", "games", "first"}},
+		{"lenient repeats", MatchLenient,
+			[]string{"/v2/teams?page=3", "/v2/teams"},
+			[]string{"teams", "teams"}},
+		{"method and path must match", MatchLenient,
+			[]string{"/v2/players"},
+			[]string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cassette.json")
+			if err := (&Cassette{Interactions: interactions}).Save(path); err != nil {
+				t.Fatal(err)
+			}
+			rep, err := NewReplayer(path, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, target := range tt.requests {
+				req := httptest.NewRequest("GET", "http://api.test"+target, nil)
+				resp, err := rep.RoundTrip(req)
+				if tt.want[i] == "" {
+					if err == nil {
+						t.Errorf("request %d: got a response, want no match", i)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.want[i] {
+					t.Errorf("request %d: got %q, want %q", i, body, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Write([]byte(`{"access_token":"abc","expires_in":3600}`))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec := NewRecorder(path, nil)
+	req, _ := http.NewRequest("POST", upstream.URL+"/v2/oauth/access_token",
+		strings.NewReader("client_id=me&client_secret=hunter2"))
+	resp, err := rec.RoundTrip(req)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("got %v, %v", resp, err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Interactions) != 1 {
+		t.Fatalf("got %d interactions, want 1", len(c.Interactions))
+	}
+	in := c.Interactions[0]
+	for _, leaked := range []string{in.Body, in.RequestBody, strings.Join(in.Header["Set-Cookie"], "")} {
+		if strings.Contains(leaked, "abc") || strings.Contains(leaked, "hunter2") {
+			t.Errorf("credentials stored in %q", leaked)
+		}
+	}
+}
+
+func TestRecorderKeepsRequest(t *testing.T) {
+	var got string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	rec := NewRecorder(filepath.Join(t.TempDir(), "cassette.json"), nil)
+	body := io.NopCloser(strings.NewReader("grant_type=client_credentials"))
+	req, _ := http.NewRequest("POST", upstream.URL+"/v2/oauth/access_token", body)
+	if _, err := rec.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Body != body {
+		t.Error("the caller's request body is replaced")
+	}
+	if got != "grant_type=client_credentials" {
+		t.Errorf("upstream got body %q", got)
+	}
+	if c := rec.cassette.Interactions; len(c) != 1 || c[0].RequestBody != "grant_type=client_credentials" {
+		t.Errorf("stored %+v", c)
+	}
+}
+
+func TestRecorderSaveFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	rec := NewRecorder(filepath.Join(t.TempDir(), "missing", "cassette.json"), nil)
+	req, _ := http.NewRequest("GET", upstream.URL+"/v2/series", nil)
+	resp, err := rec.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("the request failed with the save: %v", err)
+	}
+	if resp == nil || resp.StatusCode != 200 {
+		t.Fatalf("got %v, want the response", resp)
+	}
+	if rec.Err() == nil {
+		t.Fatal("the failed save isn't reported by Err")
+	}
+}
@@ -0,0 +1,654 @@
+package abiostest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	"github.com/PatronGG/abios-go-sdk/internal/subscription"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+)
+
+// Call is a call made to a Fake.
+type Call struct {
+	Method         string           // Name of the method, e.g. "SeriesById".
+	ID             int              // The id argument, 0 if the method has none.
+	SubscriptionID uuid.UUID        // The subscription id argument, uuid.Nil if the method has none.
+	Params         abios.Parameters // A copy of the parameters, including q for Search.
+}
+
+// Fake is an in-memory AbiosSdk serving Fixtures. List endpoints understand the games[],
+// starts_after, starts_before and page parameters, and Search understands q; other
+// parameters are ignored. Methods can be made to fail with Fail and FailNext, and every
+// call is recorded for Calls. The rate is kept for Rate but has no effect. A
+// Fake is safe for concurrent use.
+type Fake struct {
+	// PageSize is the number of items on each page of a paginated endpoint.
+	PageSize int
+
+	mu            sync.Mutex
+	fixtures      Fixtures
+	subscriptions []Subscription
+	calls         []Call
+	failures      map[string]*ErrorStruct // Until cleared.
+	nextFailures  map[string][]*ErrorStruct
+
+	second, minute int
+}
+
+var _ abios.AbiosSdk = (*Fake)(nil)
+
+// NewFake returns a Fake serving fixtures.
+func NewFake(fixtures Fixtures) *Fake {
+	f := &Fake{
+		PageSize:     DefaultPageSize,
+		failures:     make(map[string]*ErrorStruct),
+		nextFailures: make(map[string][]*ErrorStruct),
+		second:       5,
+		minute:       300,
+	}
+	f.fixtures.add(fixtures)
+	return f
+}
+
+// Add adds more fixtures.
+func (f *Fake) Add(fixtures Fixtures) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fixtures.add(fixtures)
+}
+
+// Fail makes method, e.g. "SeriesById", fail with err until Fail is called again for
+// the method with nil. Methods returning an error return err.Err, or an error describing
+// err if Err is nil.
+func (f *Fake) Fail(method string, err *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.failures, method)
+		return
+	}
+	f.failures[method] = err
+}
+
+// FailNext makes the next call to method fail with err. Calling it several times queues
+// several failures.
+func (f *Fake) FailNext(method string, err *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextFailures[method] = append(f.nextFailures[method], err)
+}
+
+// Calls returns the calls made so far to the given methods, or all calls if no method
+// is given, in the order they were made.
+func (f *Fake) Calls(methods ...string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := []Call{}
+	for _, c := range f.calls {
+		if len(methods) == 0 || contains(methods, c.Method) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// ResetCalls forgets the calls made so far.
+func (f *Fake) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// NotFound returns the ErrorStruct the API responds with for an unknown entity.
+func NotFound(description string) *ErrorStruct {
+	return &ErrorStruct{Error: "Not Found", ErrorCode: http.StatusNotFound, ErrorDescription: description}
+}
+
+// call records a call and returns the error to fail it with, if any. Must be called with
+// f.mu held.
+func (f *Fake) call(c Call) *ErrorStruct {
+	params := make(abios.Parameters, len(c.Params))
+	for k, v := range c.Params {
+		params[k] = append([]string(nil), v...)
+	}
+	c.Params = params
+	f.calls = append(f.calls, c)
+
+	if next := f.nextFailures[c.Method]; len(next) > 0 {
+		f.nextFailures[c.Method] = next[1:]
+		return next[0]
+	}
+	return f.failures[c.Method]
+}
+
+// failure is the error methods returning an error fail with. It keeps the injected
+// ErrorStruct, so that a Server can respond with its status, and unwraps to its Err.
+type failure struct {
+	err *ErrorStruct
+}
+
+func (f *failure) Error() string {
+	if f.err.Err != nil {
+		return f.err.Err.Error()
+	}
+	return f.err.String()
+}
+
+// Unwrap returns the Err of the injected ErrorStruct, if any.
+func (f *failure) Unwrap() error {
+	return f.err.Err
+}
+
+// asError converts an injected failure for methods returning an error.
+func asError(err *ErrorStruct) error {
+	if err == nil {
+		return nil
+	}
+	return &failure{err}
+}
+
+// subscriptionNotFound returns the error for an unknown subscription id. A Server
+// responds to it with 404 like the API, and its message is the one the client gives for
+// that response.
+func subscriptionNotFound(id uuid.UUID) error {
+	err := NotFound(fmt.Sprintf("Unknown subscription %s", id))
+	err.Err = fmt.Errorf("Unexpected status code %v", http.StatusNotFound)
+	return &failure{err}
+}
+
+// pageSize returns the page size to use.
+func (f *Fake) pageSize() int {
+	if f.PageSize <= 0 {
+		return DefaultPageSize
+	}
+	return f.PageSize
+}
+
+// Games returns the games on the requested page.
+func (f *Fake) Games(params abios.Parameters) (GameStructPaginated, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "Games", Params: params}); err != nil {
+		return GameStructPaginated{}, err
+	}
+
+	q := parseQuery(params)
+	var games []GameStruct
+	for _, g := range f.fixtures.Games {
+		if q.game(g) {
+			games = append(games, g)
+		}
+	}
+	from, to, current, last := q.bounds(len(games), f.pageSize())
+	return GameStructPaginated{CurrentPage: current, LastPage: last, Data: games[from:to]}, nil
+}
+
+// Series returns the series matching params on the requested page.
+func (f *Fake) Series(params abios.Parameters) (SeriesStructPaginated, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "Series", Params: params}); err != nil {
+		return SeriesStructPaginated{}, err
+	}
+
+	q := parseQuery(params)
+	series := f.fixtures.filterSeries(q)
+	from, to, current, last := q.bounds(len(series), f.pageSize())
+	return SeriesStructPaginated{CurrentPage: current, LastPage: last, Data: series[from:to]}, nil
+}
+
+// SeriesById returns the series with the given id.
+func (f *Fake) SeriesById(id int, params abios.Parameters) (SeriesStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "SeriesById", ID: id, Params: params}); err != nil {
+		return SeriesStruct{}, err
+	}
+
+	for _, s := range f.fixtures.Series {
+		if s.Id == int64(id) {
+			return s, nil
+		}
+	}
+	return SeriesStruct{}, NotFound("No series with id " + strconv.Itoa(id))
+}
+
+// MatchesById returns the match with the given id.
+func (f *Fake) MatchesById(id int, params abios.Parameters) (MatchStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "MatchesById", ID: id, Params: params}); err != nil {
+		return MatchStruct{}, err
+	}
+
+	for _, m := range f.fixtures.Matches {
+		if m.Id == int64(id) {
+			return m, nil
+		}
+	}
+	return MatchStruct{}, NotFound("No match with id " + strconv.Itoa(id))
+}
+
+// Tournaments returns the tournaments matching params on the requested page.
+func (f *Fake) Tournaments(params abios.Parameters) (TournamentStructPaginated, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "Tournaments", Params: params}); err != nil {
+		return TournamentStructPaginated{}, err
+	}
+
+	q := parseQuery(params)
+	tournaments := f.fixtures.filterTournaments(q)
+	from, to, current, last := q.bounds(len(tournaments), f.pageSize())
+	return TournamentStructPaginated{CurrentPage: current, LastPage: last, Data: tournaments[from:to]}, nil
+}
+
+// TournamentsById returns the tournament with the given id.
+func (f *Fake) TournamentsById(id int, params abios.Parameters) (TournamentStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "TournamentsById", ID: id, Params: params}); err != nil {
+		return TournamentStruct{}, err
+	}
+
+	for _, t := range f.fixtures.Tournaments {
+		if t.Id == int64(id) {
+			return t, nil
+		}
+	}
+	return TournamentStruct{}, NotFound("No tournament with id " + strconv.Itoa(id))
+}
+
+// SubstagesById returns the substage with the given id.
+func (f *Fake) SubstagesById(id int, params abios.Parameters) (SubstageStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "SubstagesById", ID: id, Params: params}); err != nil {
+		return SubstageStruct{}, err
+	}
+
+	for _, s := range f.fixtures.Substages {
+		if s.Id == int64(id) {
+			return s, nil
+		}
+	}
+	return SubstageStruct{}, NotFound("No substage with id " + strconv.Itoa(id))
+}
+
+// Teams returns the teams matching params on the requested page.
+func (f *Fake) Teams(params abios.Parameters) (TeamStructPaginated, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "Teams", Params: params}); err != nil {
+		return TeamStructPaginated{}, err
+	}
+
+	q := parseQuery(params)
+	teams := f.fixtures.filterTeams(q)
+	from, to, current, last := q.bounds(len(teams), f.pageSize())
+	return TeamStructPaginated{CurrentPage: current, LastPage: last, Data: teams[from:to]}, nil
+}
+
+// TeamsById returns the team with the given id.
+func (f *Fake) TeamsById(id int, params abios.Parameters) (TeamStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "TeamsById", ID: id, Params: params}); err != nil {
+		return TeamStruct{}, err
+	}
+
+	for _, t := range f.fixtures.Teams {
+		if t.Id == int64(id) {
+			return t, nil
+		}
+	}
+	return TeamStruct{}, NotFound("No team with id " + strconv.Itoa(id))
+}
+
+// Players returns the players matching params on the requested page.
+func (f *Fake) Players(params abios.Parameters) (PlayerStructPaginated, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "Players", Params: params}); err != nil {
+		return PlayerStructPaginated{}, err
+	}
+
+	q := parseQuery(params)
+	players := f.fixtures.filterPlayers(q)
+	from, to, current, last := q.bounds(len(players), f.pageSize())
+	return PlayerStructPaginated{CurrentPage: current, LastPage: last, Data: players[from:to]}, nil
+}
+
+// PlayersById returns the player with the given id.
+func (f *Fake) PlayersById(id int, params abios.Parameters) (PlayerStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "PlayersById", ID: id, Params: params}); err != nil {
+		return PlayerStruct{}, err
+	}
+
+	for _, p := range f.fixtures.Players {
+		if p.Id == int64(id) {
+			return p, nil
+		}
+	}
+	return PlayerStruct{}, NotFound("No player with id " + strconv.Itoa(id))
+}
+
+// RostersById returns the roster with the given id.
+func (f *Fake) RostersById(id int, params abios.Parameters) (RosterStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "RostersById", ID: id, Params: params}); err != nil {
+		return RosterStruct{}, err
+	}
+
+	for _, r := range f.fixtures.Rosters {
+		if r.Id == int64(id) {
+			return r, nil
+		}
+	}
+	return RosterStruct{}, NotFound("No roster with id " + strconv.Itoa(id))
+}
+
+// Search returns the teams, players, tournaments and organisations whose names contain
+// query.
+func (f *Fake) Search(query string, params abios.Parameters) ([]SearchResultStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	withQuery := make(abios.Parameters, len(params)+1)
+	for k, v := range params {
+		withQuery[k] = append([]string(nil), v...)
+	}
+	withQuery.Add("q", query)
+	if err := f.call(Call{Method: "Search", Params: withQuery}); err != nil {
+		return []SearchResultStruct{}, err
+	}
+
+	return f.fixtures.search(parseQuery(withQuery)), nil
+}
+
+// Incidents returns the incidents on the requested page.
+func (f *Fake) Incidents(params abios.Parameters) (IncidentStructPaginated, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "Incidents", Params: params}); err != nil {
+		return IncidentStructPaginated{}, err
+	}
+
+	q := parseQuery(params)
+	incidents := f.fixtures.Incidents
+	from, to, current, last := q.bounds(len(incidents), f.pageSize())
+	return IncidentStructPaginated{CurrentPage: current, LastPage: last, Data: incidents[from:to]}, nil
+}
+
+// IncidentsBySeriesId returns the incidents of the series with the given id.
+func (f *Fake) IncidentsBySeriesId(id int) (SeriesIncidentsStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "IncidentsBySeriesId", ID: id}); err != nil {
+		return SeriesIncidentsStruct{}, err
+	}
+
+	return f.fixtures.seriesIncidents(int64(id)), nil
+}
+
+// Organisations returns the organisations on the requested page.
+func (f *Fake) Organisations(params abios.Parameters) (OrganisationStructPaginated, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "Organisations", Params: params}); err != nil {
+		return OrganisationStructPaginated{}, err
+	}
+
+	q := parseQuery(params)
+	organisations := f.fixtures.Organisations
+	from, to, current, last := q.bounds(len(organisations), f.pageSize())
+	return OrganisationStructPaginated{CurrentPage: current, LastPage: last, Data: organisations[from:to]}, nil
+}
+
+// OrganisationsById returns the organisation with the given id.
+func (f *Fake) OrganisationsById(id int, params abios.Parameters) (OrganisationStruct, *ErrorStruct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "OrganisationsById", ID: id, Params: params}); err != nil {
+		return OrganisationStruct{}, err
+	}
+
+	for _, o := range f.fixtures.Organisations {
+		if o.Id == int64(id) {
+			return o, nil
+		}
+	}
+	return OrganisationStruct{}, NotFound("No organisation with id " + strconv.Itoa(id))
+}
+
+// TeamsByIds returns the teams with the given ids. A failure injected for TeamsByIds
+// fails every id.
+func (f *Fake) TeamsByIds(ctx context.Context, ids []int64, params abios.Parameters) map[int64]abios.BatchResult[TeamStruct] {
+	return byIds(f, "TeamsByIds", "team", ids, params, func(fx *Fixtures) []TeamStruct { return fx.Teams }, func(t TeamStruct) int64 { return t.Id })
+}
+
+// PlayersByIds returns the players with the given ids. A failure injected for
+// PlayersByIds fails every id.
+func (f *Fake) PlayersByIds(ctx context.Context, ids []int64, params abios.Parameters) map[int64]abios.BatchResult[PlayerStruct] {
+	return byIds(f, "PlayersByIds", "player", ids, params, func(fx *Fixtures) []PlayerStruct { return fx.Players }, func(p PlayerStruct) int64 { return p.Id })
+}
+
+// SeriesByIds returns the series with the given ids. A failure injected for SeriesByIds
+// fails every id.
+func (f *Fake) SeriesByIds(ctx context.Context, ids []int64, params abios.Parameters) map[int64]abios.BatchResult[SeriesStruct] {
+	return byIds(f, "SeriesByIds", "series", ids, params, func(fx *Fixtures) []SeriesStruct { return fx.Series }, func(s SeriesStruct) int64 { return s.Id })
+}
+
+// byIds records a batch call, with the ids as ids[], and returns the entities among the
+// fixtures picked by all with the given ids. Missing entities fail with NotFound.
+func byIds[T any](f *Fake, method, kind string, ids []int64, params abios.Parameters, all func(*Fixtures) []T, id func(T) int64) map[int64]abios.BatchResult[T] {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	withIds := make(abios.Parameters, len(params)+1)
+	for k, v := range params {
+		withIds[k] = append([]string(nil), v...)
+	}
+	withIds.Del("ids[]")
+	for _, i := range ids {
+		withIds.Add("ids[]", strconv.FormatInt(i, 10))
+	}
+	err := f.call(Call{Method: method, Params: withIds})
+
+	results := make(map[int64]abios.BatchResult[T], len(ids))
+	for _, i := range ids {
+		if err != nil {
+			results[i] = abios.BatchResult[T]{Err: err}
+			continue
+		}
+		results[i] = abios.BatchResult[T]{Err: NotFound("No " + kind + " with id " + strconv.FormatInt(i, 10))}
+		for _, item := range all(&f.fixtures) {
+			if id(item) == i {
+				results[i] = abios.BatchResult[T]{Value: item}
+				break
+			}
+		}
+	}
+	return results
+}
+
+// CreateSubscription registers sub and returns its new ID. If a subscription with the
+// same name and filters exists its ID is returned instead.
+func (f *Fake) CreateSubscription(sub Subscription) (uuid.UUID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "CreateSubscription"}); err != nil {
+		return uuid.Nil, asError(err)
+	}
+
+	for _, existing := range f.subscriptions {
+		if existing.Name == sub.Name && subscription.SameFilters(existing.Filters, sub.Filters) {
+			return existing.ID, nil
+		}
+	}
+
+	sub.ID = uuid.Must(uuid.NewV4())
+	f.subscriptions = append(f.subscriptions, sub)
+	return sub.ID, nil
+}
+
+// ListSubscriptions returns the registered subscriptions.
+func (f *Fake) ListSubscriptions() ([]Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "ListSubscriptions"}); err != nil {
+		return nil, asError(err)
+	}
+
+	return append([]Subscription{}, f.subscriptions...), nil
+}
+
+// UpdateSubscription replaces the subscription with the given id.
+func (f *Fake) UpdateSubscription(id uuid.UUID, sub Subscription) (Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "UpdateSubscription", SubscriptionID: id}); err != nil {
+		return Subscription{}, asError(err)
+	}
+
+	return f.update(id, sub)
+}
+
+// update replaces the subscription with the given id. Must be called with f.mu held.
+func (f *Fake) update(id uuid.UUID, sub Subscription) (Subscription, error) {
+	for i := range f.subscriptions {
+		if f.subscriptions[i].ID == id {
+			sub.ID = id
+			f.subscriptions[i] = sub
+			return sub, nil
+		}
+	}
+	return Subscription{}, subscriptionNotFound(id)
+}
+
+// DeleteSubscription removes the subscription with the given id.
+func (f *Fake) DeleteSubscription(id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "DeleteSubscription", SubscriptionID: id}); err != nil {
+		return asError(err)
+	}
+
+	return f.delete(id)
+}
+
+// delete removes the subscription with the given id. Must be called with f.mu held.
+func (f *Fake) delete(id uuid.UUID) error {
+	for i := range f.subscriptions {
+		if f.subscriptions[i].ID == id {
+			f.subscriptions = append(f.subscriptions[:i], f.subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return subscriptionNotFound(id)
+}
+
+// EnsureSubscription registers desired, or updates the subscription with the same name,
+// like the real client, deleting the other subscriptions with the name.
+func (f *Fake) EnsureSubscription(ctx context.Context, desired Subscription) (Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "EnsureSubscription"}); err != nil {
+		return Subscription{}, asError(err)
+	}
+
+	if desired.Name == "" {
+		return Subscription{}, fmt.Errorf("EnsureSubscription requires the subscription to have a name")
+	}
+
+	if existing, duplicates, found := subscription.Pick(f.subscriptions, desired); found {
+		for _, dup := range duplicates {
+			f.delete(dup.ID)
+		}
+		if subscription.UpToDate(existing, desired) {
+			return existing, nil
+		}
+		return f.update(existing.ID, desired)
+	}
+
+	desired.ID = uuid.Must(uuid.NewV4())
+	f.subscriptions = append(f.subscriptions, desired)
+	return desired, nil
+}
+
+// PruneSubscriptions deletes every subscription for which keep returns false.
+func (f *Fake) PruneSubscriptions(keep func(Subscription) bool) ([]Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "PruneSubscriptions"}); err != nil {
+		return nil, asError(err)
+	}
+	if keep == nil {
+		return nil, fmt.Errorf("PruneSubscriptions requires a keep function")
+	}
+
+	pruned := []Subscription{}
+	kept := f.subscriptions[:0]
+	for _, sub := range f.subscriptions {
+		if keep(sub) {
+			kept = append(kept, sub)
+		} else {
+			pruned = append(pruned, sub)
+		}
+	}
+	f.subscriptions = kept
+	return pruned, nil
+}
+
+// PushServiceConnect records the call. No messages are pushed.
+func (f *Fake) PushServiceConnect(subscriptionID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(Call{Method: "PushServiceConnect", SubscriptionID: subscriptionID}); err != nil {
+		return asError(err)
+	}
+	return nil
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRate sets the rate returned by Rate. It doesn't change how the Fake behaves.
+func (f *Fake) SetRate(second, minute int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if 0 < second {
+		f.second = second
+	}
+	if 0 < minute {
+		f.minute = minute
+	}
+}
+
+// Rate returns the rate set by SetRate.
+func (f *Fake) Rate() (second, minute int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.second, f.minute
+}
+
+// WithContext returns f, calls to a Fake don't depend on a context.
+func (f *Fake) WithContext(ctx context.Context) abios.AbiosSdk {
+	return f
+}
@@ -0,0 +1,174 @@
+package abiostest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// start returns a pointer to the given start time.
+func start(s string) *string {
+	return &s
+}
+
+func seriesFixtures() Fixtures {
+	return Fixtures{Series: []SeriesStruct{
+		{Id: 1, Game: GameStruct{Id: 1}, Start: start("2024-01-01T10:00:00Z")},
+		{Id: 2, Game: GameStruct{Id: 2}, Start: start("2024-01-02T10:00:00Z")},
+		{Id: 3, Game: GameStruct{Id: 1}, Start: start("2024-01-03T10:00:00Z")},
+		{Id: 4, Game: GameStruct{Id: 1}},
+		{Id: 5, Game: GameStruct{Id: 2}, Start: start("2024-01-05T10:00:00Z")},
+	}}
+}
+
+func TestFakeSeries(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      abios.Parameters
+		wantIds     []int64
+		wantCurrent int64
+		wantLast    int64
+	}{
+		{"first page", nil, []int64{1, 2}, 1, 3},
+		{"middle page", abios.Parameters{"page": {"2"}}, []int64{3, 4}, 2, 3},
+		{"last page", abios.Parameters{"page": {"3"}}, []int64{5}, 3, 3},
+		{"past the last page", abios.Parameters{"page": {"4"}}, nil, 4, 3},
+		{"invalid page", abios.Parameters{"page": {"0"}}, []int64{1, 2}, 1, 3},
+		{"games", abios.Parameters{"games[]": {"2"}}, []int64{2, 5}, 1, 1},
+		{"ids", abios.Parameters{"ids[]": {"5", "1", "9"}}, []int64{1, 5}, 1, 1},
+		{"starts after", abios.Parameters{"starts_after": {"2024-01-02T12:00:00Z"}}, []int64{3, 5}, 1, 1},
+		{"starts between", abios.Parameters{
+			"starts_after":  {"2024-01-02T00:00:00Z"},
+			"starts_before": {"2024-01-04T00:00:00Z"},
+		}, []int64{2, 3}, 1, 1},
+		{"nothing matches", abios.Parameters{"games[]": {"3"}}, nil, 1, 1},
+		{"unknown parameters", abios.Parameters{"with[]": {"matches"}}, []int64{1, 2}, 1, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFake(seriesFixtures())
+			f.PageSize = 2
+			page, err := f.Series(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int64
+			for _, s := range page.Data {
+				ids = append(ids, s.Id)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIds) {
+				t.Errorf("got series %v, want %v", ids, tt.wantIds)
+			}
+			if page.CurrentPage != tt.wantCurrent || page.LastPage != tt.wantLast {
+				t.Errorf("got page %d of %d, want %d of %d", page.CurrentPage, page.LastPage, tt.wantCurrent, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestFakeFailures(t *testing.T) {
+	f := NewFake(seriesFixtures())
+	unavailable := &ErrorStruct{Error: "Service Unavailable", ErrorCode: http.StatusServiceUnavailable}
+	f.FailNext("SeriesById", unavailable)
+	f.FailNext("SeriesById", unavailable)
+
+	for i, want := range []*ErrorStruct{unavailable, unavailable, nil} {
+		if _, err := f.SeriesById(1, nil); err != want {
+			t.Errorf("call %d: got %v, want %v", i, err, want)
+		}
+	}
+
+	f.Fail("Series", unavailable)
+	for i := 0; i < 2; i++ {
+		if _, err := f.Series(nil); err != unavailable {
+			t.Errorf("call %d: got %v, want the injected failure", i, err)
+		}
+	}
+	f.Fail("Series", nil)
+	if _, err := f.Series(nil); err != nil {
+		t.Errorf("got %v after the failure was cleared", err)
+	}
+
+	if _, err := f.SeriesById(9, nil); err == nil || err.ErrorCode != http.StatusNotFound {
+		t.Errorf("got %v for an unknown series, want not found", err)
+	}
+}
+
+func TestFakeCalls(t *testing.T) {
+	f := NewFake(seriesFixtures())
+	params := abios.Parameters{"page": {"2"}}
+	f.Series(params)
+	f.SeriesById(3, nil)
+	params.Set("page", "3") // Calls keep the parameters they were made with.
+
+	want := []Call{
+		{Method: "Series", Params: abios.Parameters{"page": {"2"}}},
+		{Method: "SeriesById", ID: 3, Params: abios.Parameters{}},
+	}
+	if got := f.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := f.Calls("SeriesById"); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("got %+v, want %+v", got, want[1:])
+	}
+
+	f.ResetCalls()
+	if got := f.Calls(); len(got) != 0 {
+		t.Errorf("got %+v after ResetCalls", got)
+	}
+}
+
+func TestFakeKeepsCallerParams(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(f *Fake, params abios.Parameters)
+		key  string
+	}{
+		{"Search", func(f *Fake, params abios.Parameters) { f.Search("final", params) }, "q"},
+		{"SeriesByIds", func(f *Fake, params abios.Parameters) {
+			f.SeriesByIds(context.Background(), []int64{3}, params)
+		}, "ids[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Spare capacity would let an append write into the caller's array.
+			values := make([]string, 1, 4)
+			values[0] = "given"
+			params := abios.Parameters{tt.key: values}
+
+			f := NewFake(seriesFixtures())
+			tt.call(f, params)
+			if got := values[:cap(values)]; got[1] != "" || len(params[tt.key]) != 1 || params[tt.key][0] != "given" {
+				t.Errorf("the caller's %s changed to %q", tt.key, got)
+			}
+
+			recorded := f.Calls(tt.name)[0].Params[tt.key]
+			recorded[0] = "changed"
+			if values[0] != "given" {
+				t.Errorf("the recorded call shares %s with the caller", tt.key)
+			}
+		})
+	}
+}
+
+func TestFakeByIds(t *testing.T) {
+	f := NewFake(seriesFixtures())
+	results := f.SeriesByIds(context.Background(), []int64{3, 9}, nil)
+
+	if r := results[3]; r.Err != nil || r.Value.Id != 3 {
+		t.Errorf("got %+v for a known series", r)
+	}
+	if r := results[9]; r.Err == nil || r.Err.ErrorCode != http.StatusNotFound {
+		t.Errorf("got %+v for an unknown series, want not found", r)
+	}
+	if calls := f.Calls("SeriesByIds"); len(calls) != 1 || !reflect.DeepEqual(calls[0].Params["ids[]"], []string{"3", "9"}) {
+		t.Errorf("got calls %+v, want one with the ids", calls)
+	}
+}
@@ -0,0 +1,252 @@
+// Package abiostest provides stand-ins for the Abios API to test code using the SDK
+// without network access or credentials.
+package abiostest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// Fixtures is the data served by a Fake.
+type Fixtures struct {
+	Games         []GameStruct
+	Series        []SeriesStruct
+	Matches       []MatchStruct
+	Tournaments   []TournamentStruct
+	Substages     []SubstageStruct
+	Teams         []TeamStruct
+	Players       []PlayerStruct
+	Rosters       []RosterStruct
+	Organisations []OrganisationStruct
+	Incidents     []IncidentStruct
+}
+
+// add appends the fixtures of other to f.
+func (f *Fixtures) add(other Fixtures) {
+	f.Games = append(f.Games, other.Games...)
+	f.Series = append(f.Series, other.Series...)
+	f.Matches = append(f.Matches, other.Matches...)
+	f.Tournaments = append(f.Tournaments, other.Tournaments...)
+	f.Substages = append(f.Substages, other.Substages...)
+	f.Teams = append(f.Teams, other.Teams...)
+	f.Players = append(f.Players, other.Players...)
+	f.Rosters = append(f.Rosters, other.Rosters...)
+	f.Organisations = append(f.Organisations, other.Organisations...)
+	f.Incidents = append(f.Incidents, other.Incidents...)
+}
+
+// DefaultPageSize is the number of items on each page of a paginated endpoint.
+const DefaultPageSize = 50
+
+// Layout of the times in the API and in the starts_after and starts_before parameters.
+const timeLayout = "2006-01-02T15:04:05Z"
+
+// query is the subset of the API parameters the stand-ins understand.
+type query struct {
+	ids          map[int64]bool // From ids[], empty means all ids.
+	games        map[int64]bool // From games[], empty means all games.
+	startsAfter  *time.Time
+	startsBefore *time.Time
+	q            string // From q, lower case.
+	page         int64
+}
+
+// parseQuery reads the parameters the stand-ins understand and ignores the rest.
+func parseQuery(params abios.Parameters) query {
+	q := query{ids: make(map[int64]bool), games: make(map[int64]bool), page: 1}
+
+	for _, v := range params["ids[]"] {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			q.ids[id] = true
+		}
+	}
+	for _, v := range params["games[]"] {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			q.games[id] = true
+		}
+	}
+	if t, ok := paramTime(params, "starts_after"); ok {
+		q.startsAfter = &t
+	}
+	if t, ok := paramTime(params, "starts_before"); ok {
+		q.startsBefore = &t
+	}
+	if v := params["q"]; len(v) > 0 {
+		q.q = strings.ToLower(v[0])
+	}
+	if v := params["page"]; len(v) > 0 {
+		if page, err := strconv.ParseInt(v[0], 10, 64); err == nil && 0 < page {
+			q.page = page
+		}
+	}
+	return q
+}
+
+// paramTime reads a time parameter.
+func paramTime(params abios.Parameters, key string) (time.Time, bool) {
+	v := params[key]
+	if len(v) == 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeLayout, v[0])
+	return t, err == nil
+}
+
+// id reports whether id is one of the requested ids.
+func (q query) id(id int64) bool {
+	return len(q.ids) == 0 || q.ids[id]
+}
+
+// game reports whether g is one of the requested games.
+func (q query) game(g GameStruct) bool {
+	return len(q.games) == 0 || q.games[g.Id]
+}
+
+// starts reports whether start is within the requested interval. Items without a start
+// only match if no interval was requested.
+func (q query) starts(start *string) bool {
+	if q.startsAfter == nil && q.startsBefore == nil {
+		return true
+	}
+	if start == nil {
+		return false
+	}
+	t, err := time.Parse(timeLayout, *start)
+	if err != nil {
+		return false
+	}
+	if q.startsAfter != nil && t.Before(*q.startsAfter) {
+		return false
+	}
+	if q.startsBefore != nil && t.After(*q.startsBefore) {
+		return false
+	}
+	return true
+}
+
+// matches reports whether any of the names contain the search query.
+func (q query) matches(names ...string) bool {
+	for _, name := range names {
+		if strings.Contains(strings.ToLower(name), q.q) {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds returns the slice bounds of the requested page among n items, and the current
+// and last page numbers as reported by the API.
+func (q query) bounds(n, pageSize int) (from, to int, current, last int64) {
+	last = int64((n + pageSize - 1) / pageSize)
+	if last == 0 {
+		last = 1
+	}
+
+	from = int(q.page-1) * pageSize
+	if from > n {
+		from = n
+	}
+	to = from + pageSize
+	if to > n {
+		to = n
+	}
+	return from, to, q.page, last
+}
+
+// filterSeries returns the series matching q.
+func (f *Fixtures) filterSeries(q query) []SeriesStruct {
+	var out []SeriesStruct
+	for _, s := range f.Series {
+		if q.id(s.Id) && q.game(s.Game) && q.starts(s.Start) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// filterTournaments returns the tournaments matching q.
+func (f *Fixtures) filterTournaments(q query) []TournamentStruct {
+	var out []TournamentStruct
+	for _, t := range f.Tournaments {
+		if q.game(t.Game) && q.starts(t.Start) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// filterTeams returns the teams matching q.
+func (f *Fixtures) filterTeams(q query) []TeamStruct {
+	var out []TeamStruct
+	for _, t := range f.Teams {
+		if q.id(t.Id) && q.game(t.Game) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// filterPlayers returns the players matching q.
+func (f *Fixtures) filterPlayers(q query) []PlayerStruct {
+	var out []PlayerStruct
+	for _, p := range f.Players {
+		if q.id(p.Id) && q.game(p.Game) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// search returns the teams, players, tournaments and organisations whose names contain
+// the search query.
+func (f *Fixtures) search(q query) []SearchResultStruct {
+	out := []SearchResultStruct{}
+	if q.q == "" {
+		return out
+	}
+
+	for _, t := range f.Teams {
+		if q.game(t.Game) && q.matches(t.Name, t.ShortName) {
+			out = append(out, SearchResultStruct{Id: t.Id, Matched: t.Name, Type: "team", GameId: t.Game.Id})
+		}
+	}
+	for _, p := range f.Players {
+		if q.game(p.Game) && q.matches(p.Nickname, p.FirstName+" "+p.LastName) {
+			out = append(out, SearchResultStruct{Id: p.Id, Matched: p.Nickname, Type: "player", GameId: p.Game.Id})
+		}
+	}
+	for _, t := range f.Tournaments {
+		if q.game(t.Game) && q.matches(t.Title, t.ShortTitle) {
+			out = append(out, SearchResultStruct{Id: t.Id, Matched: t.Title, Type: "tournament", GameId: t.Game.Id})
+		}
+	}
+	if len(q.games) == 0 {
+		for _, o := range f.Organisations {
+			if q.matches(o.Name) {
+				out = append(out, SearchResultStruct{Id: o.Id, Matched: o.Name, Type: "organisation"})
+			}
+		}
+	}
+	return out
+}
+
+// seriesIncidents returns the incidents of the series with the given id and its
+// matches.
+func (f *Fixtures) seriesIncidents(id int64) SeriesIncidentsStruct {
+	out := SeriesIncidentsStruct{SeriesIncidents: []IncidentStruct{}, MatchIncidents: []IncidentStruct{}}
+	for _, i := range f.Incidents {
+		if i.SeriesId != id {
+			continue
+		}
+		if i.MatchId == nil {
+			out.SeriesIncidents = append(out.SeriesIncidents, i)
+		} else {
+			out.MatchIncidents = append(out.MatchIncidents, i)
+		}
+	}
+	return out
+}
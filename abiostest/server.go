@@ -0,0 +1,510 @@
+package abiostest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Lifetime of the tokens issued by a Server unless changed with SetTokenLifetime.
+const default_token_lifetime = time.Hour
+
+// Server is a stand-in for the Abios REST and push APIs speaking the real wire
+// protocol, so that tests can run the real client end-to-end without network access.
+// The REST and subscription endpoints are served by Fake, which is where fixtures are
+// added, errors injected and calls inspected. Create clients for the Server with the
+// options from Options.
+type Server struct {
+	*httptest.Server
+	Fake *Fake
+
+	mu              sync.Mutex
+	clientID        string // Empty means any credentials are accepted.
+	clientSecret    string
+	tokenLifetime   time.Duration
+	tokens          map[string]time.Time    // Access token to expiry.
+	reconnectTokens map[uuid.UUID]uuid.UUID // Unused reconnect token to subscription ID.
+	sockets         map[*websocket.Conn]*socket
+	throttled       int // Number of REST requests left to answer with 429.
+	retryAfter      time.Duration
+	silent          bool // Whether pings go unanswered.
+}
+
+// socket is a connection to the push socket.
+type socket struct {
+	mu             sync.Mutex // Serializes writes.
+	subscriptionID uuid.UUID
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+// NewServer starts a Server without fixtures that accepts any credentials. Close it
+// when done.
+func NewServer() *Server {
+	s := &Server{
+		Fake:            NewFake(Fixtures{}),
+		tokenLifetime:   default_token_lifetime,
+		tokens:          make(map[string]time.Time),
+		reconnectTokens: make(map[uuid.UUID]uuid.UUID),
+		sockets:         make(map[*websocket.Conn]*socket),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/oauth/access_token", s.serveToken)
+	mux.HandleFunc("/v2/", s.serveREST)
+	mux.HandleFunc("/v0/subscription", s.serveSubscriptions)
+	mux.HandleFunc("/v0/subscription/", s.serveSubscriptions)
+	mux.HandleFunc("/v0", s.serveSocket)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Options returns the options making a client talk to the Server:
+//
+//	a := abios.New("id", "secret", srv.Options()...)
+func (s *Server) Options() []abios.Option {
+	return []abios.Option{
+		abios.WithBaseURL(s.URL + "/v2/"),
+		abios.WithPushURLs("ws"+strings.TrimPrefix(s.URL, "http")+"/v0", s.URL+"/v0/"),
+		abios.WithHTTPClient(s.Client()),
+	}
+}
+
+// Close disconnects all push sockets and shuts the Server down.
+func (s *Server) Close() {
+	s.Disconnect(websocket.CloseGoingAway, "server shutting down")
+	s.Server.Close()
+}
+
+// SetCredentials makes the Server only accept the given client ID and secret.
+func (s *Server) SetCredentials(clientID, clientSecret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientID, s.clientSecret = clientID, clientSecret
+}
+
+// SetTokenLifetime sets how long tokens issued from now on are valid.
+func (s *Server) SetTokenLifetime(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenLifetime = d
+}
+
+// ExpireTokens makes every token issued so far invalid, as if they had expired.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]time.Time)
+}
+
+// TooManyRequests answers the next n REST requests with 429 Too Many Requests and a
+// Retry-After header of retryAfter, rounded up to whole seconds.
+func (s *Server) TooManyRequests(n int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttled = n
+	s.retryAfter = retryAfter
+}
+
+// Push sends msg, e.g. a SeriesMessage from NewSeriesMessage, to every connected socket
+// whose subscription matches it.
+func (s *Server) Push(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var m PushMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	subs, _ := s.Fake.subscriptionsByID()
+	for conn, sock := range s.connected() {
+		if sub, ok := subs[sock.subscriptionID]; ok && !sub.Matches(m) {
+			continue
+		}
+		sock.mu.Lock()
+		conn.WriteMessage(websocket.TextMessage, data)
+		sock.mu.Unlock()
+	}
+	return nil
+}
+
+// NewSeriesMessage returns a message on the series channel as the push API sends it.
+func NewSeriesMessage(payloadType string, state SeriesStruct, events ...string) SeriesMessage {
+	if events == nil {
+		events = []string{}
+	}
+	return SeriesMessage{
+		Message:          Message{Channel: "series", UUID: uuid.Must(uuid.NewV4())},
+		CreatedTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:          SeriesPayload{Type: payloadType, Events: events, State: state, Diff: []Diff{}},
+	}
+}
+
+// AnswerPings sets whether the push sockets answer pings with pongs, which they do by
+// default. Turning it off lets the client's pong deadline expire, as if the connection
+// had silently died.
+func (s *Server) AnswerPings(answer bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silent = !answer
+}
+
+// Disconnect closes every push socket with the given close code, e.g.
+// abios.CloseInternalError, as if the server dropped them mid-series.
+func (s *Server) Disconnect(code int, reason string) {
+	for conn, sock := range s.connected() {
+		sock.mu.Lock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		sock.mu.Unlock()
+		conn.Close()
+	}
+}
+
+// Connections returns the number of connected push sockets.
+func (s *Server) Connections() int {
+	return len(s.connected())
+}
+
+// connected returns a snapshot of the connected sockets.
+func (s *Server) connected() map[*websocket.Conn]*socket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sockets := make(map[*websocket.Conn]*socket, len(s.sockets))
+	for conn, sock := range s.sockets {
+		sockets[conn] = sock
+	}
+	return sockets
+}
+
+// serveToken issues access tokens for the client credentials grant.
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, &ErrorStruct{Error: "Method Not Allowed", ErrorCode: http.StatusMethodNotAllowed})
+		return
+	}
+	r.ParseForm()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Form.Get("grant_type") != "client_credentials" {
+		writeError(w, &ErrorStruct{Error: "unsupported_grant_type", ErrorCode: http.StatusBadRequest,
+			ErrorDescription: "The authorization grant type is not supported."})
+		return
+	}
+	if s.clientID != "" && (r.Form.Get("client_id") != s.clientID || r.Form.Get("client_secret") != s.clientSecret) {
+		writeError(w, &ErrorStruct{Error: "invalid_client", ErrorCode: http.StatusUnauthorized,
+			ErrorDescription: "Client authentication failed."})
+		return
+	}
+
+	token := uuid.Must(uuid.NewV4()).String()
+	s.tokens[token] = time.Now().Add(s.tokenLifetime)
+	writeJSON(w, http.StatusOK, AccessTokenStruct{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.tokenLifetime / time.Second),
+	})
+}
+
+// authorized reports whether the request carries a valid access token, and answers it
+// with 401 if not.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if s.validToken(r.URL.Query().Get("access_token")) {
+		return true
+	}
+	writeError(w, &ErrorStruct{Error: "invalid_token", ErrorCode: http.StatusUnauthorized,
+		ErrorDescription: "The access token provided is invalid."})
+	return false
+}
+
+// validToken reports whether token was issued and hasn't expired.
+func (s *Server) validToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.tokens[token]
+	return ok && time.Now().Before(expires)
+}
+
+// throttle reports whether the request should be answered with 429, and does so.
+func (s *Server) throttle(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.throttled <= 0 {
+		return false
+	}
+	s.throttled--
+
+	seconds := int((s.retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, &ErrorStruct{Error: "Too Many Requests", ErrorCode: http.StatusTooManyRequests,
+		ErrorDescription: "Rate limit exceeded."})
+	return true
+}
+
+// serveREST serves the v2 endpoints from Fake.
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) || s.throttle(w) {
+		return
+	}
+
+	params := abios.Parameters(r.URL.Query())
+	delete(params, "access_token")
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v2/"), "/"), "/")
+	id := 0
+	if len(parts) == 2 {
+		var err error
+		if id, err = strconv.Atoi(parts[1]); err != nil {
+			writeError(w, NotFound("Unknown endpoint "+r.URL.Path))
+			return
+		}
+	} else if len(parts) > 2 {
+		writeError(w, NotFound("Unknown endpoint "+r.URL.Path))
+		return
+	}
+
+	var v interface{}
+	var err *ErrorStruct
+	switch endpoint := parts[0]; {
+	case endpoint == "games" && id == 0:
+		v, err = s.Fake.Games(params)
+	case endpoint == "series" && id == 0:
+		v, err = s.Fake.Series(params)
+	case endpoint == "series":
+		v, err = s.Fake.SeriesById(id, params)
+	case endpoint == "matches" && id != 0:
+		v, err = s.Fake.MatchesById(id, params)
+	case endpoint == "tournaments" && id == 0:
+		v, err = s.Fake.Tournaments(params)
+	case endpoint == "tournaments":
+		v, err = s.Fake.TournamentsById(id, params)
+	case endpoint == "substages" && id != 0:
+		v, err = s.Fake.SubstagesById(id, params)
+	case endpoint == "teams" && id == 0:
+		v, err = s.Fake.Teams(params)
+	case endpoint == "teams":
+		v, err = s.Fake.TeamsById(id, params)
+	case endpoint == "players" && id == 0:
+		v, err = s.Fake.Players(params)
+	case endpoint == "players":
+		v, err = s.Fake.PlayersById(id, params)
+	case endpoint == "rosters" && id != 0:
+		v, err = s.Fake.RostersById(id, params)
+	case endpoint == "search" && id == 0:
+		query := r.URL.Query().Get("q")
+		delete(params, "q")
+		v, err = s.Fake.Search(query, params)
+	case endpoint == "incidents" && id == 0:
+		v, err = s.Fake.Incidents(params)
+	case endpoint == "incidents":
+		v, err = s.Fake.IncidentsBySeriesId(id)
+	case endpoint == "organisations" && id == 0:
+		v, err = s.Fake.Organisations(params)
+	case endpoint == "organisations":
+		v, err = s.Fake.OrganisationsById(id, params)
+	default:
+		err = NotFound("Unknown endpoint " + r.URL.Path)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// serveSubscriptions serves the subscription endpoints of the push API from Fake.
+func (s *Server) serveSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+
+	idStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v0/subscription"), "/")
+	if idStr == "" {
+		switch r.Method {
+		case "GET":
+			subs, err := s.Fake.ListSubscriptions()
+			respond(w, subs, err)
+		case "POST":
+			var sub Subscription
+			if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+				writeError(w, &ErrorStruct{Error: "Bad Request", ErrorCode: http.StatusBadRequest, ErrorDescription: err.Error()})
+				return
+			}
+			id, err := s.Fake.CreateSubscription(sub)
+			respond(w, OnlyID{ID: id}, err)
+		default:
+			writeError(w, &ErrorStruct{Error: "Method Not Allowed", ErrorCode: http.StatusMethodNotAllowed})
+		}
+		return
+	}
+
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		writeError(w, NotFound("Unknown subscription "+idStr))
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		var sub Subscription
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+			writeError(w, &ErrorStruct{Error: "Bad Request", ErrorCode: http.StatusBadRequest, ErrorDescription: err.Error()})
+			return
+		}
+		updated, err := s.Fake.UpdateSubscription(id, sub)
+		respond(w, updated, err)
+	case "DELETE":
+		err := s.Fake.DeleteSubscription(id)
+		respond(w, OnlyID{ID: id}, err)
+	default:
+		writeError(w, &ErrorStruct{Error: "Method Not Allowed", ErrorCode: http.StatusMethodNotAllowed})
+	}
+}
+
+// serveSocket serves the push socket. The connection is set up like the push API does,
+// closing it with the push API's close codes if the setup request is invalid and
+// sending an init message otherwise.
+func (s *Server) serveSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	refuse := func(code int, reason string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		conn.Close()
+	}
+
+	q := r.URL.Query()
+	token := q.Get("access_token")
+	if token == "" {
+		refuse(abios.CloseMissingAccessToken, "missing access token")
+		return
+	}
+	if !s.validToken(token) {
+		refuse(abios.CloseInvalidAccessToken, "invalid access token")
+		return
+	}
+
+	if q.Get("subscription_id") == "" {
+		refuse(abios.CloseMissingSubscriptionID, "missing subscription id")
+		return
+	}
+	subs, _ := s.Fake.subscriptionsByID()
+	subscriptionID, err := uuid.FromString(q.Get("subscription_id"))
+	sub, ok := subs[subscriptionID]
+	if err != nil || !ok {
+		refuse(abios.CloseUnknownSubscriptionID, "unknown subscription id")
+		return
+	}
+
+	s.mu.Lock()
+	reconnected := false
+	if rt := q.Get("reconnect_token"); rt != "" {
+		previous, err := uuid.FromString(rt)
+		if err != nil || s.reconnectTokens[previous] != subscriptionID {
+			s.mu.Unlock()
+			refuse(abios.CloseInvalidReconnectToken, "invalid reconnect token")
+			return
+		}
+		delete(s.reconnectTokens, previous) // A reconnect token can only be used once.
+		reconnected = true
+	}
+	reconnectToken := uuid.Must(uuid.NewV4())
+	s.reconnectTokens[reconnectToken] = subscriptionID
+	sock := &socket{subscriptionID: subscriptionID}
+	s.sockets[conn] = sock
+	s.mu.Unlock()
+
+	sock.mu.Lock()
+	conn.WriteJSON(InitResponseMessage{
+		SystemMessage: SystemMessage{
+			Message: Message{Channel: "system", UUID: uuid.Must(uuid.NewV4())},
+			Cmd:     "init",
+		},
+		SubscriberID:   uuid.Must(uuid.NewV4()),
+		ReconnectToken: reconnectToken,
+		Subscription:   sub,
+		Reconnected:    reconnected,
+	})
+	sock.mu.Unlock()
+
+	conn.SetPingHandler(func(data string) error {
+		s.mu.Lock()
+		silent := s.silent
+		s.mu.Unlock()
+		if silent {
+			return nil
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// Reading answers pings and notices when the client goes away.
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.sockets, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// subscriptionsByID returns the registered subscriptions by ID without recording a call.
+func (f *Fake) subscriptionsByID() (map[uuid.UUID]Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	subs := make(map[uuid.UUID]Subscription, len(f.subscriptions))
+	for _, sub := range f.subscriptions {
+		subs[sub.ID] = sub
+	}
+	return subs, nil
+}
+
+// respond writes v as JSON, or an error response if err isn't nil. Failures injected
+// into Fake are written with their own ErrorStruct, other errors as 500.
+func respond(w http.ResponseWriter, v interface{}, err error) {
+	var f *failure
+	if errors.As(err, &f) {
+		writeError(w, f.err)
+		return
+	}
+	if err != nil {
+		writeError(w, &ErrorStruct{Error: "Error", ErrorCode: http.StatusInternalServerError, ErrorDescription: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// writeError writes err with its ErrorCode as status, or 500 if that isn't an HTTP
+// error status.
+func writeError(w http.ResponseWriter, err *ErrorStruct) {
+	status := int(err.ErrorCode)
+	if status < 400 || 599 < status {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, err)
+}
+
+// writeJSON writes v as JSON with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,293 @@
+package abiostest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// token requests an access token from s with the given form.
+func token(t *testing.T, s *Server, form url.Values) (int, AccessTokenStruct) {
+	t.Helper()
+	resp, err := http.PostForm(s.URL+"/v2/oauth/access_token", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var tok AccessTokenStruct
+	json.NewDecoder(resp.Body).Decode(&tok)
+	return resp.StatusCode, tok
+}
+
+// get requests path from s with the access token and returns the closed response.
+func get(t *testing.T, s *Server, path, accessToken string) *http.Response {
+	t.Helper()
+	resp, err := http.Get(s.URL + path + "?access_token=" + accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// dial connects to the push socket of s with the given query.
+func dial(t *testing.T, s *Server, query url.Values) *websocket.Conn {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(s.URL, "http") + "/v0?" + query.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// initMessage reads the init message from conn.
+func initMessage(t *testing.T, conn *websocket.Conn) InitResponseMessage {
+	t.Helper()
+	var m InitResponseMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestServerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{"valid", url.Values{"grant_type": {"client_credentials"}, "client_id": {"id"}, "client_secret": {"secret"}}, 200},
+		{"wrong secret", url.Values{"grant_type": {"client_credentials"}, "client_id": {"id"}, "client_secret": {"guess"}}, 401},
+		{"wrong grant", url.Values{"grant_type": {"password"}, "client_id": {"id"}, "client_secret": {"secret"}}, 400},
+	}
+
+	s := NewServer()
+	defer s.Close()
+	s.SetCredentials("id", "secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, tok := token(t, s, tt.form)
+			if status != tt.status {
+				t.Fatalf("got status %d, want %d", status, tt.status)
+			}
+			if status == 200 && (tok.AccessToken == "" || tok.ExpiresIn != int64(default_token_lifetime/time.Second)) {
+				t.Fatalf("got token %+v", tok)
+			}
+		})
+	}
+}
+
+func TestServerREST(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Fake.Add(Fixtures{Series: []SeriesStruct{{Id: 1}}})
+	_, tok := token(t, s, url.Values{"grant_type": {"client_credentials"}})
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"list", "/v2/series", tok.AccessToken, 200},
+		{"by id", "/v2/series/1", tok.AccessToken, 200},
+		{"unknown id", "/v2/series/2", tok.AccessToken, 404},
+		{"invalid id", "/v2/series/first", tok.AccessToken, 404},
+		{"unknown endpoint", "/v2/casters", tok.AccessToken, 404},
+		{"no token", "/v2/series", "", 401},
+		{"unknown token", "/v2/series", "guess", 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := get(t, s, tt.path, tt.token); resp.StatusCode != tt.status {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+
+	s.ExpireTokens()
+	if resp := get(t, s, "/v2/series", tok.AccessToken); resp.StatusCode != 401 {
+		t.Fatalf("got status %d with an expired token, want 401", resp.StatusCode)
+	}
+}
+
+func TestServerTooManyRequests(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	_, tok := token(t, s, url.Values{"grant_type": {"client_credentials"}})
+	s.TooManyRequests(2, 1500*time.Millisecond)
+
+	for i, want := range []int{429, 429, 200} {
+		resp := get(t, s, "/v2/series", tok.AccessToken)
+		if resp.StatusCode != want {
+			t.Fatalf("request %d: got status %d, want %d", i, resp.StatusCode, want)
+		}
+		if want == 429 && resp.Header.Get("Retry-After") != "2" {
+			t.Fatalf("request %d: got Retry-After %q, want 2", i, resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestServerSubscriptionFailures(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	_, tok := token(t, s, url.Values{"grant_type": {"client_credentials"}})
+
+	tests := []struct {
+		name   string
+		err    *ErrorStruct
+		status int
+	}{
+		{"not found", NotFound("gone"), 404},
+		{"rate limited", &ErrorStruct{Error: "Too Many Requests", ErrorCode: 429}, 429},
+		{"no status", &ErrorStruct{Error: "Error", Err: errors.New("broken")}, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Fake.FailNext("ListSubscriptions", tt.err)
+			resp := get(t, s, "/v0/subscription", tok.AccessToken)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestServerUnknownSubscription(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	_, tok := token(t, s, url.Values{"grant_type": {"client_credentials"}})
+	path := s.URL + "/v0/subscription/" + uuid.Must(uuid.NewV4()).String() + "?access_token=" + tok.AccessToken
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		t.Run(method, func(t *testing.T) {
+			req, err := http.NewRequest(method, path, strings.NewReader(`{"name":"scores"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Fatalf("got status %d, want 404", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServerSocketInit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	_, tok := token(t, s, url.Values{"grant_type": {"client_credentials"}})
+	id, err := s.Fake.CreateSubscription(Subscription{Name: "scores", Filters: []SubscriptionFilter{{Channel: "series"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := url.Values{"access_token": {tok.AccessToken}, "subscription_id": {id.String()}}
+
+	first := initMessage(t, dial(t, s, query))
+	if first.Cmd != "init" || first.Channel != "system" {
+		t.Errorf("got %s message on %s, want init on system", first.Cmd, first.Channel)
+	}
+	if first.Subscription.ID != id || first.Subscription.Name != "scores" {
+		t.Errorf("got subscription %+v, want %v", first.Subscription, id)
+	}
+	if first.ReconnectToken == uuid.Nil || first.Reconnected {
+		t.Errorf("got reconnect token %v, reconnected %v on the first connection", first.ReconnectToken, first.Reconnected)
+	}
+
+	query.Set("reconnect_token", first.ReconnectToken.String())
+	second := initMessage(t, dial(t, s, query))
+	if !second.Reconnected {
+		t.Error("a connection with a reconnect token isn't marked reconnected")
+	}
+	if second.ReconnectToken == first.ReconnectToken {
+		t.Error("the reconnect token isn't renewed")
+	}
+
+	reused := dial(t, s, query)
+	reused.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = reused.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != abios.CloseInvalidReconnectToken {
+		t.Errorf("reusing a reconnect token: got %v, want close code %d", err, abios.CloseInvalidReconnectToken)
+	}
+	if n := s.Connections(); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+}
+
+func TestServerSocketRefused(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	_, tok := token(t, s, url.Values{"grant_type": {"client_credentials"}})
+	id, err := s.Fake.CreateSubscription(Subscription{Name: "scores"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.Fake.CreateSubscription(Subscription{Name: "odds"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken := initMessage(t, dial(t, s, url.Values{"access_token": {tok.AccessToken}, "subscription_id": {other.String()}})).ReconnectToken
+
+	tests := []struct {
+		name  string
+		query url.Values
+		code  int
+	}{
+		{"no access token", url.Values{"subscription_id": {id.String()}}, abios.CloseMissingAccessToken},
+		{"invalid access token", url.Values{"access_token": {"guess"}, "subscription_id": {id.String()}}, abios.CloseInvalidAccessToken},
+		{"no subscription", url.Values{"access_token": {tok.AccessToken}}, abios.CloseMissingSubscriptionID},
+		{"unknown subscription", url.Values{"access_token": {tok.AccessToken}, "subscription_id": {uuid.Must(uuid.NewV4()).String()}}, abios.CloseUnknownSubscriptionID},
+		{"unknown reconnect token", url.Values{"access_token": {tok.AccessToken}, "subscription_id": {id.String()}, "reconnect_token": {uuid.Must(uuid.NewV4()).String()}}, abios.CloseInvalidReconnectToken},
+		{"reconnect token of another subscription", url.Values{"access_token": {tok.AccessToken}, "subscription_id": {id.String()}, "reconnect_token": {otherToken.String()}}, abios.CloseInvalidReconnectToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, s, tt.query)
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, _, err := conn.ReadMessage()
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != tt.code {
+				t.Fatalf("got %v, want close code %d", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestServerDisconnect(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	_, tok := token(t, s, url.Values{"grant_type": {"client_credentials"}})
+	id, err := s.Fake.CreateSubscription(Subscription{Name: "scores"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dial(t, s, url.Values{"access_token": {tok.AccessToken}, "subscription_id": {id.String()}})
+	initMessage(t, conn)
+
+	s.Disconnect(abios.CloseInternalError, "maintenance")
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != abios.CloseInternalError || closeErr.Text != "maintenance" {
+		t.Fatalf("got %v, want close code %d", err, abios.CloseInternalError)
+	}
+}
@@ -0,0 +1,204 @@
+package abios
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Lowest fraction of the configured rate the adaptive rate goes down to.
+	adaptive_min_factor = 0.05
+
+	// The fraction of the quota left in the rate-limit headers below which we slow down.
+	adaptive_low_remaining = 0.1
+
+	// How long without signs of pressure before the rate is raised a step.
+	adaptive_recover_interval = 30 * time.Second
+	adaptive_recover_step     = 0.1
+)
+
+// adaptiveRate lowers the outgoing rate when the API signals that we are sending too
+// much, through 429 responses or rate-limit headers, and slowly raises it back once the
+// pressure is gone. The rate set by SetRate is the ceiling, it is never exceeded.
+type adaptiveRate struct {
+	mu           sync.Mutex
+	enabled      bool
+	factor       float64      // Fraction of the ceiling currently allowed.
+	throttle     *RateLimiter // Enforces the effective rate.
+	pausedUntil  time.Time    // Set from Retry-After.
+	lastPressure time.Time
+	lastRecover  time.Time
+	logger       Logger
+}
+
+// newAdaptiveRate returns an enabled adaptiveRate that allows the full ceiling.
+func newAdaptiveRate() *adaptiveRate {
+	return &adaptiveRate{
+		enabled:  true,
+		factor:   1,
+		throttle: NewLimiter(default_requests_per_second, default_requests_per_minute),
+		logger:   nopLogger{},
+	}
+}
+
+// wait blocks until the effective rate allows another request.
+func (a *adaptiveRate) wait(ctx context.Context, ceilingSecond, ceilingMinute int) error {
+	a.mu.Lock()
+	if !a.enabled {
+		a.mu.Unlock()
+		return nil
+	}
+	a.recover(time.Now(), ceilingSecond, ceilingMinute)
+	second, minute := a.effective(ceilingSecond, ceilingMinute)
+	a.throttle.SetRate(second, minute)
+	pause := time.Until(a.pausedUntil)
+	a.mu.Unlock()
+
+	if 0 < pause {
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return a.throttle.Wait(ctx)
+}
+
+// observe adjusts the rate from the status code and headers of a response.
+func (a *adaptiveRate) observe(res result, ceilingSecond, ceilingMinute int) {
+	now := time.Now()
+	pressure := false
+	factor := 1.0
+
+	if res.statuscode == http.StatusTooManyRequests {
+		pressure = true
+		factor = 0.5
+	} else if remaining, limit, ok := rateLimitHeaders(res.header); ok && 0 < limit &&
+		float64(remaining) < adaptive_low_remaining*float64(limit) {
+		pressure = true
+		factor = 0.8
+	}
+
+	if !pressure {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.enabled {
+		return
+	}
+
+	if retry, ok := retryAfter(res.header, now); ok && a.pausedUntil.Before(retry) {
+		a.pausedUntil = retry
+	}
+
+	// Several responses to requests sent at the old rate may signal pressure at once,
+	// only react to the first of them.
+	if now.Sub(a.lastPressure) < time.Second {
+		return
+	}
+	a.lastPressure = now
+	a.lastRecover = now
+
+	a.factor *= factor
+	if a.factor < adaptive_min_factor {
+		a.factor = adaptive_min_factor
+	}
+
+	second, minute := a.effective(ceilingSecond, ceilingMinute)
+	a.logger.Info("Server signalled rate pressure, effective rate lowered",
+		"status", res.statuscode, "per_second", second, "per_minute", minute)
+}
+
+// recover raises the factor a step if there has been no pressure for a while. Must be
+// called with a.mu held.
+func (a *adaptiveRate) recover(now time.Time, ceilingSecond, ceilingMinute int) {
+	if a.factor >= 1 || now.Sub(a.lastRecover) < adaptive_recover_interval {
+		return
+	}
+	a.lastRecover = now
+
+	a.factor += adaptive_recover_step
+	if a.factor > 1 {
+		a.factor = 1
+	}
+
+	second, minute := a.effective(ceilingSecond, ceilingMinute)
+	a.logger.Info("Effective rate raised", "per_second", second, "per_minute", minute)
+}
+
+// effective returns the currently allowed rate. Must be called with a.mu held.
+func (a *adaptiveRate) effective(ceilingSecond, ceilingMinute int) (second, minute int) {
+	if !a.enabled {
+		return ceilingSecond, ceilingMinute
+	}
+
+	second = int(float64(ceilingSecond) * a.factor)
+	minute = int(float64(ceilingMinute) * a.factor)
+	if second < 1 {
+		second = 1
+	}
+	if minute < 1 {
+		minute = 1
+	}
+	return second, minute
+}
+
+// setEnabled turns adaptation on or off. Turning it off restores the full rate.
+func (a *adaptiveRate) setEnabled(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.enabled = enabled
+	a.factor = 1
+	a.pausedUntil = time.Time{}
+}
+
+// rateLimitHeaders reads the remaining and total number of requests from the rate-limit
+// headers of a response, if present.
+func rateLimitHeaders(h http.Header) (remaining, limit int, ok bool) {
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		r, errR := strconv.Atoi(h.Get(prefix + "Remaining"))
+		l, errL := strconv.Atoi(h.Get(prefix + "Limit"))
+		if errR == nil && errL == nil {
+			return r, l, true
+		}
+	}
+	return 0, 0, false
+}
+
+// retryAfter reads the Retry-After header, given either in seconds or as a date.
+func retryAfter(h http.Header, now time.Time) (time.Time, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// SetAdaptiveRate turns adapting the outgoing rate to the rate-limit signals of the API
+// on or off. It is on by default.
+func (a *client) SetAdaptiveRate(enabled bool) {
+	a.handler.adaptive.setEnabled(enabled)
+}
+
+// EffectiveRate returns the outgoing rate currently used, which is lower than the rate
+// set by SetRate while the API signals that we are sending too much.
+func (a *client) EffectiveRate() (second, minute int) {
+	ceilingSecond, ceilingMinute := a.handler.rate()
+	a.handler.adaptive.mu.Lock()
+	defer a.handler.adaptive.mu.Unlock()
+	return a.handler.adaptive.effective(ceilingSecond, ceilingMinute)
+}
@@ -0,0 +1,85 @@
+package abios
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRateObserve(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		wantSecond int
+		wantMinute int
+		wantPause  bool
+	}{
+		{"ok", 200, nil, 10, 600, false},
+		{"too many requests", 429, nil, 5, 300, false},
+		{"retry after", 429, http.Header{"Retry-After": {"2"}}, 5, 300, true},
+		{"low remaining", 200, http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Limit": {"100"}}, 8, 480, false},
+		{"enough remaining", 200, http.Header{"Ratelimit-Remaining": {"50"}, "Ratelimit-Limit": {"100"}}, 10, 600, false},
+		{"malformed headers", 200, http.Header{"X-Ratelimit-Remaining": {"few"}, "X-Ratelimit-Limit": {"100"}}, 10, 600, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAdaptiveRate()
+			a.observe(result{statuscode: tt.status, header: tt.header}, 10, 600)
+
+			if second, minute := a.effective(10, 600); second != tt.wantSecond || minute != tt.wantMinute {
+				t.Errorf("got rate (%d, %d), want (%d, %d)", second, minute, tt.wantSecond, tt.wantMinute)
+			}
+			if paused := a.pausedUntil.After(time.Now()); paused != tt.wantPause {
+				t.Errorf("got paused %v, want %v", paused, tt.wantPause)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRateOnePressurePerSecond(t *testing.T) {
+	a := newAdaptiveRate()
+	for i := 0; i < 3; i++ {
+		a.observe(result{statuscode: 429}, 10, 600)
+	}
+	if a.factor != 0.5 {
+		t.Fatalf("got factor %v after a burst of 429s, want 0.5", a.factor)
+	}
+}
+
+func TestAdaptiveRateRecover(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		factor     float64
+		sinceLast  time.Duration // Time since the last pressure or step.
+		wantFactor float64
+	}{
+		{"too soon", 0.5, 10 * time.Second, 0.5},
+		{"a step", 0.5, adaptive_recover_interval, 0.6},
+		{"capped at the ceiling", 0.95, adaptive_recover_interval, 1},
+		{"at the ceiling", 1, time.Hour, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAdaptiveRate()
+			a.factor = tt.factor
+			a.lastRecover = now.Add(-tt.sinceLast)
+			a.recover(now, 10, 600)
+			if diff := a.factor - tt.wantFactor; diff < -1e-9 || 1e-9 < diff {
+				t.Fatalf("got factor %v, want %v", a.factor, tt.wantFactor)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRateDisabled(t *testing.T) {
+	a := newAdaptiveRate()
+	a.setEnabled(false)
+	a.observe(result{statuscode: 429, header: http.Header{"Retry-After": {"60"}}}, 10, 600)
+	if second, minute := a.effective(10, 600); second != 10 || minute != 600 || !a.pausedUntil.IsZero() {
+		t.Fatalf("got rate (%d, %d) and pause %v while disabled", second, minute, a.pausedUntil)
+	}
+}
@@ -0,0 +1,180 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// How many IDs are requested from a list endpoint at once.
+const default_batch_size = 50
+
+// How many by-ID requests a batch has in flight at most. It is lowered to a quarter of
+// the queue capacity for small queues, so a batch never fills the queue.
+const default_batch_concurrency = 4
+
+// BatchResult is the outcome of fetching one entity in a batch. Err is nil if Value was
+// fetched.
+type BatchResult[T any] struct {
+	Value T
+	Err   *ErrorStruct
+}
+
+// TeamsByIds fetches the teams with the given ids, e.g. the teams of a page of series.
+// See batch for how the teams are requested.
+func (a *client) TeamsByIds(ctx context.Context, ids []int64, params Parameters) map[int64]BatchResult[TeamStruct] {
+	return batch(a.withContext(ctx), "Teams", teams, teamsById, ids, params,
+		func(p TeamStructPaginated) ([]TeamStruct, int64, int64) { return p.Data, p.CurrentPage, p.LastPage },
+		func(t TeamStruct) int64 { return t.Id })
+}
+
+// PlayersByIds fetches the players with the given ids. See batch for how the players are
+// requested.
+func (a *client) PlayersByIds(ctx context.Context, ids []int64, params Parameters) map[int64]BatchResult[PlayerStruct] {
+	return batch(a.withContext(ctx), "Players", players, playersById, ids, params,
+		func(p PlayerStructPaginated) ([]PlayerStruct, int64, int64) { return p.Data, p.CurrentPage, p.LastPage },
+		func(p PlayerStruct) int64 { return p.Id })
+}
+
+// SeriesByIds fetches the series with the given ids. See batch for how the series are
+// requested.
+func (a *client) SeriesByIds(ctx context.Context, ids []int64, params Parameters) map[int64]BatchResult[SeriesStruct] {
+	return batch(a.withContext(ctx), "Series", series, seriesById, ids, params,
+		func(p SeriesStructPaginated) ([]SeriesStruct, int64, int64) { return p.Data, p.CurrentPage, p.LastPage },
+		func(s SeriesStruct) int64 { return s.Id })
+}
+
+// batch fetches the entities with the given ids, which may contain duplicates, from the
+// list endpoint filtered by "ids[]", default_batch_size at a time. The entities a list
+// request doesn't return, or fails for with an error a by-ID request could avoid, are
+// requested from the by-ID endpoint concurrently instead, which also gives each missing
+// entity its own error. method names
+// the list endpoint in spans, page returns the entities, current page and last page of
+// a response and id the ID of an entity.
+func batch[T, P any](a *client, method, list, byId string, ids []int64, params Parameters,
+	page func(P) ([]T, int64, int64), id func(T) int64) map[int64]BatchResult[T] {
+
+	results := make(map[int64]BatchResult[T], len(ids))
+	unique := make([]int64, 0, len(ids))
+	wanted := make(map[int64]bool, len(ids))
+	for _, i := range ids {
+		if !wanted[i] {
+			wanted[i] = true
+			unique = append(unique, i)
+		}
+	}
+
+	for start := 0; start < len(unique); start += default_batch_size {
+		end := start + default_batch_size
+		if end > len(unique) {
+			end = len(unique)
+		}
+		listPages(a, method, list, unique[start:end], params, page, id, results)
+	}
+
+	var missing []int64
+	for _, i := range unique {
+		if _, ok := results[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+
+	slots := make(chan struct{}, batchConcurrency(a.handler.queueCapacity()))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, i := range missing {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int64) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			value, err := get[T](withCall(a.ctx, method+"ById"), a, byId+strconv.FormatInt(i, 10), params)
+			mu.Lock()
+			results[i] = BatchResult[T]{Value: value, Err: errorStruct(err)}
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// batchConcurrency returns how many by-ID requests a batch may have in flight with a
+// queue of the given capacity. The queue is shared with every other caller, so a batch
+// must leave most of it to them.
+func batchConcurrency(capacity int) int {
+	n := capacity / 4
+	if n > default_batch_concurrency {
+		n = default_batch_concurrency
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// listPages requests the entities with the given ids from the list endpoint, a page at
+// a time, and adds those returned to results. It stops once every id is found, when a
+// page holds none of them or at the page that must be the last one if every page is
+// as full as the first, so a filter the API ignores doesn't make it crawl the whole
+// list.
+func listPages[T, P any](a *client, method, list string, ids []int64, params Parameters,
+	page func(P) ([]T, int64, int64), id func(T) int64, results map[int64]BatchResult[T]) {
+
+	remaining := make(map[int64]bool, len(ids))
+	p := params.clone()
+	p.Del("ids[]")
+	for _, i := range ids {
+		remaining[i] = true
+		p.Add("ids[]", strconv.FormatInt(i, 10))
+	}
+
+	maxPages := int64(1)
+	for n := int64(1); n <= maxPages; n++ {
+		p.Set("page", strconv.FormatInt(n, 10))
+		res, err := get[P](withCall(a.ctx, method+"ByIds"), a, list, p)
+		if err != nil {
+			if failsEveryRequest(err) {
+				for i := range remaining {
+					e := *errorStruct(err)
+					results[i] = BatchResult[T]{Err: &e}
+				}
+			}
+			return // Otherwise the rest are requested by ID.
+		}
+
+		items, current, last := page(res)
+		found := false
+		for _, item := range items {
+			if i := id(item); remaining[i] {
+				results[i] = BatchResult[T]{Value: item}
+				delete(remaining, i)
+				found = true
+			}
+		}
+		if !found || len(remaining) == 0 || current >= last {
+			return
+		}
+		if n == 1 {
+			maxPages = int64((len(ids) + len(items) - 1) / len(items))
+		}
+	}
+}
+
+// failsEveryRequest reports whether err, returned by a list request, would fail the
+// by-ID requests just the same: the API or the quota is rate limiting us, the circuit
+// breaker is open or the caller gave up. Requesting every entity by ID then would only
+// make it worse.
+func failsEveryRequest(err error) bool {
+	var rerr *requestError
+	if errors.As(err, &rerr) && rerr.status == http.StatusTooManyRequests {
+		return true
+	}
+	return errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrCircuitOpen) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,216 @@
+package abios
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// teamsAPI serves /teams from a list of team IDs, pageSize at a time, filtered by ids[]
+// unless ignoreFilter is set, and /teams/:id for every ID. /teams answers with
+// listStatus instead if it's set. It counts the requests to each.
+type teamsAPI struct {
+	teams        []int64
+	pageSize     int
+	ignoreFilter bool
+	listStatus   int
+
+	mu   sync.Mutex
+	list int
+	byID int
+}
+
+func (api *teamsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if r.URL.Path != "/v2/teams" {
+		api.byID++
+		id, _ := strconv.ParseInt(r.URL.Path[len("/v2/teams/"):], 10, 64)
+		json.NewEncoder(w).Encode(TeamStruct{Id: id})
+		return
+	}
+
+	api.list++
+	if api.listStatus != 0 {
+		w.WriteHeader(api.listStatus)
+		w.Write([]byte(`{"error":"failed","error_code":1}`))
+		return
+	}
+	wanted := make(map[string]bool)
+	for _, id := range r.URL.Query()["ids[]"] {
+		wanted[id] = true
+	}
+	var teams []TeamStruct
+	for _, id := range api.teams {
+		if api.ignoreFilter || wanted[strconv.FormatInt(id, 10)] {
+			teams = append(teams, TeamStruct{Id: id})
+		}
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	last := (len(teams) + api.pageSize - 1) / api.pageSize
+	from, to := (page-1)*api.pageSize, page*api.pageSize
+	if from > len(teams) {
+		from = len(teams)
+	}
+	if to > len(teams) {
+		to = len(teams)
+	}
+	json.NewEncoder(w).Encode(TeamStructPaginated{CurrentPage: int64(page), LastPage: int64(last), Data: teams[from:to]})
+}
+
+func TestBatchPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		api      *teamsAPI
+		ids      []int64
+		wantList int // Requests to the list endpoint.
+		wantByID int // Requests to the by-ID endpoint.
+	}{
+		{"one page", &teamsAPI{teams: []int64{1, 2, 3}, pageSize: 50}, []int64{1, 2, 3, 2}, 1, 0},
+		{"several pages", &teamsAPI{teams: []int64{1, 2, 3, 4, 5}, pageSize: 2}, []int64{1, 2, 3, 4, 5}, 3, 0},
+		{"missing ids", &teamsAPI{teams: []int64{1, 2}, pageSize: 50}, []int64{1, 2, 3}, 1, 1},
+		{"filter ignored, none on the first page", &teamsAPI{teams: []int64{10, 11, 12, 13, 1}, pageSize: 2, ignoreFilter: true},
+			[]int64{1, 2}, 1, 2},
+		{"filter ignored, stops after enough pages", &teamsAPI{teams: []int64{1, 10, 11, 2, 12, 3}, pageSize: 2, ignoreFilter: true},
+			[]int64{1, 2, 3}, 2, 1},
+		{"more ids than a batch", &teamsAPI{teams: ids(1, 60), pageSize: 50}, ids(1, 60), 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestClient(t, tt.api)
+			results := a.TeamsByIds(context.Background(), tt.ids, nil)
+
+			for _, id := range tt.ids {
+				res, ok := results[id]
+				if !ok || res.Err != nil || res.Value.Id != id {
+					t.Errorf("team %d: got %+v", id, res)
+				}
+			}
+			if tt.api.list != tt.wantList || tt.api.byID != tt.wantByID {
+				t.Errorf("got %d list and %d by-ID requests, want %d and %d",
+					tt.api.list, tt.api.byID, tt.wantList, tt.wantByID)
+			}
+		})
+	}
+}
+
+func TestBatchListFails(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantByID  int  // Requests to the by-ID endpoint.
+		wantError bool // Whether every team fails with the list error.
+	}{
+		{"rate limited", http.StatusTooManyRequests, 0, true},
+		{"server error", http.StatusInternalServerError, 3, false},
+		{"bad request", http.StatusBadRequest, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &teamsAPI{teams: []int64{1, 2, 3}, pageSize: 50, listStatus: tt.status}
+			a := newTestClient(t, api)
+			results := a.TeamsByIds(context.Background(), []int64{1, 2, 3}, nil)
+
+			for _, id := range []int64{1, 2, 3} {
+				res := results[id]
+				if tt.wantError && (res.Err == nil || res.Err.Error != "failed") {
+					t.Errorf("team %d: got %+v, want the list error", id, res)
+				}
+				if !tt.wantError && (res.Err != nil || res.Value.Id != id) {
+					t.Errorf("team %d: got %+v", id, res)
+				}
+			}
+			if api.list != 1 || api.byID != tt.wantByID {
+				t.Errorf("got %d list and %d by-ID requests, want 1 and %d", api.list, api.byID, tt.wantByID)
+			}
+		})
+	}
+}
+
+func TestBatchCancelled(t *testing.T) {
+	api := &teamsAPI{teams: []int64{1, 2, 3}, pageSize: 50}
+	a := newTestClient(t, api)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := a.TeamsByIds(ctx, []int64{1, 2, 3}, nil)
+	for _, id := range []int64{1, 2, 3} {
+		if res := results[id]; res.Err == nil || !errors.Is(res.Err.Err, context.Canceled) {
+			t.Errorf("team %d: got %+v, want it cancelled", id, res)
+		}
+	}
+	if api.list != 0 || api.byID != 0 {
+		t.Errorf("got %d list and %d by-ID requests, want none", api.list, api.byID)
+	}
+}
+
+// depthRecorder is a Metrics keeping the deepest queue lane reported.
+type depthRecorder struct {
+	nopMetrics
+	mu  sync.Mutex
+	max int
+}
+
+func (m *depthRecorder) Set(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name == metricQueueDepth && int(value) > m.max {
+		m.max = int(value)
+	}
+}
+
+func TestBatchLeavesRoomInQueue(t *testing.T) {
+	api := &teamsAPI{teams: ids(1, 40), pageSize: 50, listStatus: http.StatusInternalServerError}
+	a := newTestClient(t, api)
+	a.SetQueueCapacity(8)
+	a.SetOverflowPolicy(OverflowFailFast)
+	depth := &depthRecorder{}
+	a.SetMetrics(depth)
+
+	results := a.TeamsByIds(context.Background(), ids(1, 40), nil)
+	for _, id := range ids(1, 40) {
+		if res := results[id]; res.Err != nil || res.Value.Id != id {
+			t.Errorf("team %d: got %+v", id, res)
+		}
+	}
+	if want := batchConcurrency(8); depth.max > want {
+		t.Errorf("the batch queued %d requests at once, want at most %d", depth.max, want)
+	}
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	tests := []struct {
+		capacity int
+		want     int
+	}{
+		{1, 1},
+		{8, 2},
+		{16, 4},
+		{1000, default_batch_concurrency},
+	}
+
+	for _, tt := range tests {
+		if got := batchConcurrency(tt.capacity); got != tt.want {
+			t.Errorf("batchConcurrency(%d) = %d, want %d", tt.capacity, got, tt.want)
+		}
+	}
+}
+
+// ids returns the IDs from first to last.
+func ids(first, last int64) []int64 {
+	var out []int64
+	for i := first; i <= last; i++ {
+		out = append(out, i)
+	}
+	return out
+}
@@ -0,0 +1,287 @@
+package abios
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+)
+
+// Default buffer size of a Subscriber if none is specified.
+const default_subscriber_buffer_size = 64
+
+// ErrSourceClosed is reported on a Broker's Errors when its source closes the message
+// channel, wrapping the last error the source reported, if any. The broker is closed
+// after reporting it.
+var ErrSourceClosed = errors.New("abios: push source closed")
+
+// PushSource is implemented by anything that can deliver series messages from the
+// push API, e.g. the client returned by New. PushServiceClose closes the connection
+// PushServiceInit made.
+type PushSource interface {
+	PushServiceInit(subscriptionID uuid.UUID) (chan SeriesMessage, chan error)
+	PushServiceClose() error
+}
+
+// BufferPolicy decides what happens when a Subscriber's buffer is full.
+type BufferPolicy int
+
+const (
+	BufferDropNewest BufferPolicy = iota // Discard the message that didn't fit.
+	BufferDropOldest                     // Discard the oldest buffered message to make room.
+	BufferDisconnect                     // Unsubscribe the subscriber and close its channel.
+)
+
+// SubscriberOptions configures a Subscriber.
+type SubscriberOptions struct {
+	Filters    []SeriesFilter // Only messages accepted by every filter are delivered.
+	BufferSize int            // Number of messages buffered. 0 or less means default.
+	Policy     BufferPolicy   // What to do when the buffer is full.
+}
+
+// Subscriber receives the messages a Broker fans out to it.
+type Subscriber struct {
+	broker  *Broker
+	ch      chan SeriesMessage
+	opts    SubscriberOptions
+	dropped uint64
+	mu      sync.Mutex // Guards ch while sending and closing.
+	closed  bool
+}
+
+// Messages returns the channel messages are delivered on. It is closed when the
+// subscriber leaves the broker.
+func (s *Subscriber) Messages() <-chan SeriesMessage {
+	return s.ch
+}
+
+// Dropped returns how many messages were discarded because the buffer was full.
+func (s *Subscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close removes the subscriber from its broker and closes its channel.
+func (s *Subscriber) Close() {
+	s.broker.remove(s)
+}
+
+// deliver hands m to the subscriber without ever blocking. It returns false if the
+// subscriber should be disconnected.
+func (s *Subscriber) deliver(m SeriesMessage) bool {
+	for _, f := range s.opts.Filters {
+		if !f(m) {
+			return true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+
+	select {
+	case s.ch <- m:
+		return true
+	default:
+	}
+
+	switch s.opts.Policy {
+	case BufferDropOldest:
+		select {
+		case <-s.ch:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+		select {
+		case s.ch <- m:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+		return true
+	case BufferDisconnect:
+		return false
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return true
+	}
+}
+
+// close closes the subscriber's channel once.
+func (s *Subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// Broker owns a single push connection and fans its messages out to any number of
+// in-process subscribers. Each subscriber has its own buffer so a slow subscriber
+// never holds up the others.
+type Broker struct {
+	source      PushSource
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+	errors      chan error
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewBroker connects to the push API through source using the given subscription
+// and starts fanning out messages.
+func NewBroker(source PushSource, subscriptionID uuid.UUID) *Broker {
+	b := &Broker{
+		source:      source,
+		subscribers: make(map[*Subscriber]struct{}),
+		errors:      make(chan error, 1),
+		done:        make(chan struct{}),
+	}
+
+	series, errs := source.PushServiceInit(subscriptionID)
+	go b.run(series, errs)
+	return b
+}
+
+// Subscribe attaches a new subscriber to the broker. Subscribers can join and leave
+// at any time.
+func (b *Broker) Subscribe(opts SubscriberOptions) *Subscriber {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = default_subscriber_buffer_size
+	}
+
+	s := &Subscriber{
+		broker: b,
+		ch:     make(chan SeriesMessage, opts.BufferSize),
+		opts:   opts,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.done:
+		s.close() // The broker is closed, so will never be delivered anything.
+	default:
+		b.subscribers[s] = struct{}{}
+	}
+	return s
+}
+
+// Errors returns the channel on which errors from the push connection are reported.
+// Errors are dropped if nobody is reading.
+func (b *Broker) Errors() <-chan error {
+	return b.errors
+}
+
+// Close detaches all subscribers, stops delivering messages and closes the push
+// connection.
+func (b *Broker) Close() {
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		close(b.done)
+		subs := b.subscribers
+		b.subscribers = make(map[*Subscriber]struct{})
+		b.mu.Unlock()
+
+		for s := range subs {
+			s.close()
+		}
+		b.source.PushServiceClose()
+	})
+}
+
+// remove detaches s from the broker.
+func (b *Broker) remove(s *Subscriber) {
+	b.mu.Lock()
+	delete(b.subscribers, s)
+	b.mu.Unlock()
+	s.close()
+}
+
+// run reads from the push connection until the broker is closed. If the source closes
+// its message channel the broker reports ErrSourceClosed and closes itself.
+func (b *Broker) run(series <-chan SeriesMessage, errs <-chan error) {
+	var last error // The last error of the source, which is why it closed if it did.
+	for {
+		select {
+		case <-b.done:
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil // Messages can still arrive, so keep reading those.
+				continue
+			}
+			last = err
+			b.report(err)
+		case m, ok := <-series:
+			if !ok {
+				if err := pending(errs); err != nil {
+					last = err
+				}
+				err := ErrSourceClosed
+				if last != nil {
+					err = fmt.Errorf("%w: %v", ErrSourceClosed, last)
+				}
+				b.reportFinal(err)
+				b.Close()
+				return
+			}
+			b.publish(m)
+		}
+	}
+}
+
+// pending returns the last error waiting on errs, or nil if none is.
+func pending(errs <-chan error) (last error) {
+	for {
+		select {
+		case err, ok := <-errs:
+			if !ok {
+				return last
+			}
+			last = err
+		default:
+			return last
+		}
+	}
+}
+
+// report sends err on Errors unless nobody is reading.
+func (b *Broker) report(err error) {
+	select {
+	case b.errors <- err:
+	default:
+	}
+}
+
+// reportFinal sends err on Errors, discarding an error nobody read yet to make room, so
+// the reason the broker closed isn't lost.
+func (b *Broker) reportFinal(err error) {
+	select {
+	case <-b.errors:
+	default:
+	}
+	b.report(err)
+}
+
+// publish delivers m to every subscriber, disconnecting those that asked for it when
+// they can't keep up.
+func (b *Broker) publish(m SeriesMessage) {
+	var slow []*Subscriber
+
+	b.mu.RLock()
+	for s := range b.subscribers {
+		if !s.deliver(m) {
+			slow = append(slow, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, s := range slow {
+		b.remove(s)
+	}
+}
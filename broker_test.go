@@ -0,0 +1,249 @@
+package abios_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	"github.com/PatronGG/abios-go-sdk/abiostest"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+)
+
+// chanSource is a PushSource whose messages and errors are sent by the test. The
+// channels are unbuffered, so once a send returns the broker has published every
+// message sent before it.
+type chanSource struct {
+	series chan SeriesMessage
+	errors chan error
+}
+
+func newChanSource() *chanSource {
+	return &chanSource{series: make(chan SeriesMessage), errors: make(chan error)}
+}
+
+func (s *chanSource) PushServiceInit(uuid.UUID) (chan SeriesMessage, chan error) {
+	return s.series, s.errors
+}
+
+func (s *chanSource) PushServiceClose() error { return nil }
+
+// send pushes a message for each series id.
+func (s *chanSource) send(ids ...int64) {
+	for _, id := range ids {
+		s.series <- abiostest.NewSeriesMessage("update", SeriesStruct{Id: id})
+	}
+}
+
+// sync pushes a message with series id 0, which skipZero filters out, so the messages
+// sent before it are known to be delivered.
+func (s *chanSource) sync() {
+	s.send(0)
+}
+
+// skipZero drops the messages sync sends.
+func skipZero(m SeriesMessage) bool {
+	return m.Payload.State.Id != 0
+}
+
+// buffered returns the series ids buffered by sub, and whether its channel is closed.
+func buffered(sub *abios.Subscriber) (ids []int64, closed bool) {
+	for {
+		select {
+		case m, ok := <-sub.Messages():
+			if !ok {
+				return ids, true
+			}
+			ids = append(ids, m.Payload.State.Id)
+		default:
+			return ids, false
+		}
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+
+	id, err := a.CreateSubscription(Subscription{Name: "broker", Filters: []SubscriptionFilter{{Channel: "series"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := abios.NewBroker(a, id)
+	sub := b.Subscribe(abios.SubscriberOptions{BufferSize: 1})
+
+	server.Push(abiostest.NewSeriesMessage("update", SeriesStruct{Id: 1}))
+	select {
+	case m := <-sub.Messages():
+		if m.Payload.State.Id != 1 {
+			t.Fatalf("got series %d, want 1", m.Payload.State.Id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+	}
+
+	b.Close()
+	if _, ok := <-sub.Messages(); ok {
+		t.Fatal("the subscriber's channel is still open")
+	}
+
+	// Nobody reads the connection's messages anymore, which must not keep it open.
+	for i := 0; i < 3; i++ {
+		server.Push(abiostest.NewSeriesMessage("update", SeriesStruct{Id: 2}))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Connections() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d push connections still open after Close", server.Connections())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBrokerSlowSubscriber(t *testing.T) {
+	source := newChanSource()
+	b := abios.NewBroker(source, uuid.Nil)
+	defer b.Close()
+
+	slow := b.Subscribe(abios.SubscriberOptions{BufferSize: 1, Filters: []abios.SeriesFilter{skipZero}})
+	fast := b.Subscribe(abios.SubscriberOptions{BufferSize: 1, Filters: []abios.SeriesFilter{skipZero}})
+
+	for id := int64(1); id <= 10; id++ {
+		source.send(id)
+		select {
+		case m := <-fast.Messages():
+			if m.Payload.State.Id != id {
+				t.Fatalf("got series %d, want %d", m.Payload.State.Id, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("series %d isn't delivered while another subscriber is full", id)
+		}
+	}
+
+	source.sync()
+	if got := slow.Dropped(); got != 9 {
+		t.Errorf("the slow subscriber dropped %d messages, want 9", got)
+	}
+	if got := fast.Dropped(); got != 0 {
+		t.Errorf("the fast subscriber dropped %d messages, want 0", got)
+	}
+}
+
+func TestBrokerBufferPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      abios.BufferPolicy
+		want        []int64
+		wantDropped uint64
+		wantClosed  bool
+	}{
+		{"drop newest", abios.BufferDropNewest, []int64{1, 2}, 2, false},
+		{"drop oldest", abios.BufferDropOldest, []int64{3, 4}, 2, false},
+		{"disconnect", abios.BufferDisconnect, []int64{1, 2}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newChanSource()
+			b := abios.NewBroker(source, uuid.Nil)
+			defer b.Close()
+			sub := b.Subscribe(abios.SubscriberOptions{
+				BufferSize: 2,
+				Policy:     tt.policy,
+				Filters:    []abios.SeriesFilter{skipZero},
+			})
+
+			source.send(1, 2, 3, 4)
+			source.sync()
+
+			got, closed := buffered(sub)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got series %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got series %v, want %v", got, tt.want)
+				}
+			}
+			if closed != tt.wantClosed {
+				t.Errorf("closed = %v, want %v", closed, tt.wantClosed)
+			}
+			if sub.Dropped() != tt.wantDropped {
+				t.Errorf("dropped %d messages, want %d", sub.Dropped(), tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestBrokerSourceClosed(t *testing.T) {
+	source := newChanSource()
+	b := abios.NewBroker(source, uuid.Nil)
+	sub := b.Subscribe(abios.SubscriberOptions{})
+
+	// A closed error channel is ignored, messages are still delivered.
+	close(source.errors)
+	source.send(1)
+	select {
+	case m := <-sub.Messages():
+		if m.Payload.State.Id != 1 {
+			t.Fatalf("got series %d, want 1", m.Payload.State.Id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered after the error channel closed")
+	}
+
+	close(source.series)
+	select {
+	case err := <-b.Errors():
+		if !errors.Is(err, abios.ErrSourceClosed) {
+			t.Fatalf("got error %v, want %v", err, abios.ErrSourceClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the closed source isn't reported")
+	}
+	select {
+	case _, ok := <-sub.Messages():
+		if ok {
+			t.Fatal("got a message after the source closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscriber's channel is still open after the source closed")
+	}
+}
+
+func TestBrokerReconnectRefused(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+
+	id, err := a.CreateSubscription(Subscription{Name: "broker", Filters: []SubscriptionFilter{{Channel: "series"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := abios.NewBroker(a, id)
+	sub := b.Subscribe(abios.SubscriberOptions{})
+
+	// The client can't authenticate again, so it can't reconnect after the disconnect.
+	server.SetCredentials("other", "credentials")
+	server.Disconnect(abios.CloseInternalError, "maintenance")
+
+	select {
+	case _, ok := <-sub.Messages():
+		if ok {
+			t.Fatal("got a message after the connection was lost")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscriber's channel is still open after the reconnect failed")
+	}
+	// Nobody read Errors while the broker closed, the reason must still be there.
+	select {
+	case err := <-b.Errors():
+		if !errors.Is(err, abios.ErrSourceClosed) {
+			t.Fatalf("got error %v, want %v", err, abios.ErrSourceClosed)
+		}
+	default:
+		t.Fatal("the failed reconnect isn't reported")
+	}
+}
@@ -0,0 +1,183 @@
+package abios
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default values for the circuit breaker.
+const (
+	default_circuit_threshold = 5                // Consecutive failures before it opens.
+	default_circuit_cooldown  = 30 * time.Second // Time open before a probe is let through.
+)
+
+// CircuitState is the state of the circuit breaker around the REST API.
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // Requests are sent as usual.
+	CircuitOpen                         // Requests fail with ErrCircuitOpen.
+	CircuitHalfOpen                     // A single probe is sent to see if the API is back.
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// circuitBreaker stops sending requests while the API appears to be down, so callers
+// fail fast instead of waiting in the queue for requests that will time out. It opens
+// after a number of consecutive transport errors or 5xx responses. Once the cooldown has
+// passed a single request is let through as a probe; if it succeeds the breaker closes,
+// otherwise it opens again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int // Consecutive failures while closed.
+	threshold int
+	cooldown  time.Duration
+	openedAt  time.Time
+	probing   bool // Whether the probe is in flight while half-open.
+	onChange  func(from, to CircuitState)
+}
+
+// newCircuitBreaker returns a closed circuitBreaker with default settings.
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		state:     CircuitClosed,
+		threshold: default_circuit_threshold,
+		cooldown:  default_circuit_cooldown,
+	}
+}
+
+// rejects reports whether new requests should fail immediately, i.e the breaker is open
+// and the cooldown hasn't passed.
+func (c *circuitBreaker) rejects(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == CircuitOpen && now.Sub(c.openedAt) < c.cooldown
+}
+
+// allow reports whether a request may be sent now. While half-open only the probe is
+// allowed.
+func (c *circuitBreaker) allow(now time.Time) bool {
+	c.mu.Lock()
+	from := c.state
+	allowed := true
+
+	switch c.state {
+	case CircuitOpen:
+		if now.Sub(c.openedAt) < c.cooldown {
+			allowed = false
+			break
+		}
+		c.state = CircuitHalfOpen
+		c.probing = true
+	case CircuitHalfOpen:
+		if c.probing {
+			allowed = false
+			break
+		}
+		c.probing = true
+	}
+
+	to, onChange := c.state, c.onChange
+	c.mu.Unlock()
+
+	if from != to && onChange != nil {
+		onChange(from, to)
+	}
+	return allowed
+}
+
+// record updates the breaker with the outcome of a request sent with ctx. Only
+// transport errors and 5xx responses count as failures. Requests whose ctx is done, e.g.
+// cancelled by the caller, and requests the SDK itself failed say nothing about the API
+// and are ignored.
+func (c *circuitBreaker) record(ctx context.Context, res result, now time.Time) {
+	failed := res.transport || 500 <= res.statuscode
+
+	c.mu.Lock()
+	from := c.state
+
+	if ctx.Err() != nil || res.statuscode == 0 && !res.transport {
+		c.probing = false
+		c.mu.Unlock()
+		return
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			break
+		}
+		c.failures++
+		if c.failures >= c.threshold {
+			c.state = CircuitOpen
+			c.openedAt = now
+		}
+	case CircuitHalfOpen:
+		c.probing = false
+		if failed {
+			c.state = CircuitOpen
+			c.openedAt = now
+		} else {
+			c.state = CircuitClosed
+			c.failures = 0
+		}
+	}
+
+	to, onChange := c.state, c.onChange
+	c.mu.Unlock()
+
+	if from != to && onChange != nil {
+		onChange(from, to)
+	}
+}
+
+// current returns the state of the breaker.
+func (c *circuitBreaker) current() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// SetCircuitBreaker sets how many consecutive transport errors or 5xx responses open the
+// circuit breaker and how long it stays open before probing the API. A value less than
+// or equal to 0 means the previous value is kept. Default values are (5, 30s).
+func (a *client) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	c := a.handler.breaker
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if 0 < threshold {
+		c.threshold = threshold
+	}
+
+	if 0 < cooldown {
+		c.cooldown = cooldown
+	}
+}
+
+// OnCircuitStateChange sets a function called whenever the circuit breaker changes
+// state.
+func (a *client) OnCircuitStateChange(fn func(from, to CircuitState)) {
+	c := a.handler.breaker
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = fn
+}
+
+// CircuitState returns the state of the circuit breaker.
+func (a *client) CircuitState() CircuitState {
+	return a.handler.breaker.current()
+}
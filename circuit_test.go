@@ -0,0 +1,136 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerRecord(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := context.Background()
+
+	ok := result{statuscode: 200}
+	notFound := result{statuscode: 404}
+	serverError := result{statuscode: 503}
+	transport := errorResult("when attempting to perform HTTP request", errors.New("connection refused"))
+	transport.transport = true
+	sdkError := errorResult("when parsing URL", errors.New("bad URL"))
+
+	tests := []struct {
+		name     string
+		state    CircuitState
+		failures int // Consecutive failures before the outcome.
+		ctx      context.Context
+		res      result
+		want     CircuitState
+		wantFail int // Consecutive failures after the outcome, while closed.
+	}{
+		{"success resets failures", CircuitClosed, 3, ctx, ok, CircuitClosed, 0},
+		{"4xx is a success", CircuitClosed, 3, ctx, notFound, CircuitClosed, 0},
+		{"5xx counts", CircuitClosed, 3, ctx, serverError, CircuitClosed, 4},
+		{"transport error counts", CircuitClosed, 3, ctx, transport, CircuitClosed, 4},
+		{"threshold opens", CircuitClosed, 4, ctx, serverError, CircuitOpen, 5},
+		{"sdk error ignored", CircuitClosed, 4, ctx, sdkError, CircuitClosed, 4},
+		{"cancelled ignored", CircuitClosed, 4, cancelled, transport, CircuitClosed, 4},
+		{"cancelled success ignored", CircuitClosed, 4, cancelled, ok, CircuitClosed, 4},
+		{"probe success closes", CircuitHalfOpen, 0, ctx, ok, CircuitClosed, 0},
+		{"probe failure opens", CircuitHalfOpen, 0, ctx, transport, CircuitOpen, 0},
+		{"cancelled probe ignored", CircuitHalfOpen, 0, cancelled, serverError, CircuitHalfOpen, 0},
+		{"sdk error probe ignored", CircuitHalfOpen, 0, ctx, sdkError, CircuitHalfOpen, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCircuitBreaker()
+			c.state = tt.state
+			c.failures = tt.failures
+			c.probing = tt.state == CircuitHalfOpen
+
+			c.record(tt.ctx, tt.res, time.Now())
+			if c.state != tt.want {
+				t.Errorf("state = %v, want %v", c.state, tt.want)
+			}
+			if tt.want != CircuitHalfOpen && tt.state == CircuitClosed && c.failures != tt.wantFail {
+				t.Errorf("failures = %d, want %d", c.failures, tt.wantFail)
+			}
+			if c.probing {
+				t.Error("the probe is still marked in flight")
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerCooldown(t *testing.T) {
+	c := newCircuitBreaker()
+	c.threshold = 1
+	start := time.Now()
+	var changes []CircuitState
+	c.onChange = func(from, to CircuitState) { changes = append(changes, to) }
+
+	c.record(context.Background(), result{statuscode: 500}, start)
+	if !c.rejects(start.Add(time.Second)) || c.allow(start.Add(time.Second)) {
+		t.Fatal("requests are let through while open")
+	}
+
+	probe := start.Add(c.cooldown)
+	if c.rejects(probe) || !c.allow(probe) {
+		t.Fatal("the probe isn't let through after the cooldown")
+	}
+	if c.allow(probe) {
+		t.Fatal("a second request is let through while probing")
+	}
+	c.record(context.Background(), result{statuscode: 200}, probe)
+
+	want := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("got changes %v, want %v", changes, want)
+		}
+	}
+}
+
+// countingLimiter is a Limiter that counts the waits and never lets a request through.
+type countingLimiter struct {
+	waits int32
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&l.waits, 1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCircuitOpenFailsQueuedRequests(t *testing.T) {
+	r := newTestHandler()
+	limiter := &countingLimiter{}
+	r.limiter = limiter
+
+	var queued []*request
+	for i := 0; i < 3; i++ {
+		queued = append(queued, r.addRequest(context.Background(), "", nil))
+	}
+	r.breaker.threshold = 1
+	r.breaker.record(context.Background(), result{statuscode: 500}, time.Now())
+	go r.dispatcher()
+
+	for i, req := range queued {
+		select {
+		case res := <-req.ch:
+			if !errors.Is(res.err, ErrCircuitOpen) {
+				t.Fatalf("request %d: got %v, want %v", i, res.err, ErrCircuitOpen)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request %d queued before the breaker opened is still waiting", i)
+		}
+	}
+	if n := atomic.LoadInt32(&limiter.waits); n != 0 {
+		t.Errorf("waited %d times for the limiter, want none", n)
+	}
+}
@@ -0,0 +1,146 @@
+// Command abios-schema-check compares recorded responses from the Abios API with the
+// structs the SDK decodes them into, to tell which structs need updating when the API
+// changes its payloads. It works offline against cassettes recorded with
+// abiostest.Recorder, or against plain JSON files saved from a single endpoint:
+//
+//	abios-schema-check testdata/*.json
+//	abios-schema-check -endpoint /v2/series/:id series.json
+//
+// The report lists, per struct, the fields the API sends that aren't modelled, the
+// values that can't be decoded into their field, e.g. a float into an int64 or a string
+// into a struct, and the fields that are declared but weren't in any response. The exit
+// status is 1 if there are missing fields or mismatches, and 2 if the input can't be read.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/PatronGG/abios-go-sdk/abiostest"
+	"github.com/PatronGG/abios-go-sdk/internal/route"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "", "the endpoint of files that aren't cassettes, e.g. /v2/series/:id")
+	unseen := flag.Bool("unseen", true, "report declared fields that weren't in any response")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), "\nKnown endpoints:")
+		for _, e := range endpoints() {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-22s %v\n", e, endpointTypes[e])
+		}
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := newChecker()
+	for _, path := range flag.Args() {
+		if err := checkFile(c, path, *endpoint); err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", path, err)
+			os.Exit(2)
+		}
+	}
+
+	if report(os.Stdout, c, *unseen) {
+		os.Exit(1)
+	}
+}
+
+// checkFile checks the responses in the file at path. Files with an "interactions" key
+// are read as cassettes, other files as a response from endpoint.
+func checkFile(c *checker, path, endpoint string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var probe map[string]json.RawMessage
+	if json.Unmarshal(data, &probe) == nil && probe["interactions"] != nil {
+		cassette, err := abiostest.LoadCassette(path)
+		if err != nil {
+			return err
+		}
+		for _, in := range cassette.Interactions {
+			if in.Status < 200 || 300 <= in.Status {
+				continue // Error responses aren't decoded into the structs.
+			}
+			family := route.Family(in.Path)
+			t, ok := endpointTypes[family]
+			if !ok {
+				continue // E.g. the token endpoint.
+			}
+			if err := c.check(family, t, []byte(in.Body)); err != nil {
+				return fmt.Errorf("%v %v: %v", in.Method, in.Path, err)
+			}
+		}
+		return nil
+	}
+
+	if endpoint == "" {
+		return fmt.Errorf("not a cassette, use -endpoint to tell which endpoint it is from")
+	}
+	family := route.Family(endpoint)
+	t, ok := endpointTypes[family]
+	if !ok {
+		return fmt.Errorf("unknown endpoint %v", endpoint)
+	}
+	return c.check(family, t, data)
+}
+
+// report writes the findings of c to w, grouped by struct, and reports whether there
+// were missing fields or mismatches.
+func report(w io.Writer, c *checker, unseen bool) bool {
+	type line struct {
+		key  fieldKey
+		text string
+	}
+	var lines []line
+	for _, f := range sortFindings(c.missing) {
+		lines = append(lines, line{f.key, fmt.Sprintf("missing   %-24s %v, e.g. %v", f.key.name, f.detail, f.example)})
+	}
+	for _, f := range sortFindings(c.mismatches) {
+		lines = append(lines, line{f.key, fmt.Sprintf("mismatch  %-24s %v, e.g. %v", f.key.name, f.detail, f.example)})
+	}
+	if unseen {
+		for _, k := range c.unseen() {
+			lines = append(lines, line{k, fmt.Sprintf("unseen    %v", k.name)})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].key.owner < lines[j].key.owner })
+
+	owner := ""
+	for _, l := range lines {
+		if l.key.owner != owner {
+			owner = l.key.owner
+			fmt.Fprintln(w, owner)
+		}
+		fmt.Fprintln(w, "  "+l.text)
+	}
+
+	drift := len(c.missing) + len(c.mismatches)
+	if drift == 0 {
+		fmt.Fprintln(w, "No missing fields or mismatches.")
+	} else {
+		fmt.Fprintf(w, "%v missing fields, %v mismatches.\n", len(c.missing), len(c.mismatches))
+	}
+	return drift > 0
+}
+
+// endpoints returns the known endpoints in order.
+func endpoints() []string {
+	var out []string
+	for e := range endpointTypes {
+		out = append(out, e)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// endpointTypes maps the endpoints of the v2 API, with IDs replaced by ":id", to the
+// types the SDK decodes their responses into.
+var endpointTypes = map[string]reflect.Type{
+	"/v2/games":             reflect.TypeOf(GameStructPaginated{}),
+	"/v2/series":            reflect.TypeOf(SeriesStructPaginated{}),
+	"/v2/series/:id":        reflect.TypeOf(SeriesStruct{}),
+	"/v2/matches/:id":       reflect.TypeOf(MatchStruct{}),
+	"/v2/tournaments":       reflect.TypeOf(TournamentStructPaginated{}),
+	"/v2/tournaments/:id":   reflect.TypeOf(TournamentStruct{}),
+	"/v2/substages/:id":     reflect.TypeOf(SubstageStruct{}),
+	"/v2/teams":             reflect.TypeOf(TeamStructPaginated{}),
+	"/v2/teams/:id":         reflect.TypeOf(TeamStruct{}),
+	"/v2/players":           reflect.TypeOf(PlayerStructPaginated{}),
+	"/v2/players/:id":       reflect.TypeOf(PlayerStruct{}),
+	"/v2/rosters/:id":       reflect.TypeOf(RosterStruct{}),
+	"/v2/search":            reflect.TypeOf([]SearchResultStruct{}),
+	"/v2/incidents":         reflect.TypeOf(IncidentStructPaginated{}),
+	"/v2/incidents/:id":     reflect.TypeOf(SeriesIncidentsStruct{}),
+	"/v2/organisations":     reflect.TypeOf(OrganisationStructPaginated{}),
+	"/v2/organisations/:id": reflect.TypeOf(OrganisationStruct{}),
+}
+
+var (
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// field is a field of a struct as seen by encoding/json.
+type field struct {
+	name string // The JSON key.
+	typ  reflect.Type
+}
+
+// fieldKey identifies a field by the struct declaring it.
+type fieldKey struct {
+	owner string // The struct, e.g. "SeriesStruct" or "RosterStatsStruct.nemesis.match".
+	name  string // The JSON key.
+}
+
+// finding is a difference between the payloads and the structs.
+type finding struct {
+	key     fieldKey
+	detail  string // What was seen, e.g. "number" or "got string, declared int64".
+	example string // Where it was first seen, e.g. "/v2/series/:id $.tournament.links".
+}
+
+// checker compares payloads with the types they are decoded into and collects the
+// differences across all payloads it is given.
+type checker struct {
+	missing    map[fieldKey]*finding // Keys in payloads that no field decodes.
+	mismatches map[fieldKey]*finding // Values that can't be decoded into their field.
+	declared   map[fieldKey]bool     // Fields of the structs the payloads reached.
+	seen       map[fieldKey]bool     // Fields present in at least one payload.
+}
+
+func newChecker() *checker {
+	return &checker{
+		missing:    make(map[fieldKey]*finding),
+		mismatches: make(map[fieldKey]*finding),
+		declared:   make(map[fieldKey]bool),
+		seen:       make(map[fieldKey]bool),
+	}
+}
+
+// check compares the payload from endpoint with t.
+func (c *checker) check(endpoint string, t reflect.Type, payload []byte) error {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(string(payload)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	c.walk(endpoint, v, t, typeName(t), fieldKey{}, "$")
+	return nil
+}
+
+// walk compares v with t. owner names the struct the value is a field of, as key, and
+// path is its location in the payload.
+func (c *checker) walk(endpoint string, v interface{}, t reflect.Type, owner string, key fieldKey, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if v == nil {
+		return // Every field can be null, it decodes to the zero value.
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		return // Types decoding themselves decide what they accept.
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshaler) {
+		c.expect(endpoint, v, "string", t, key, path)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			c.mismatch(endpoint, v, t, key, path)
+			return
+		}
+		fields := jsonFields(t)
+		for _, f := range fields {
+			c.declared[fieldKey{owner, f.name}] = true
+		}
+		for name, value := range object {
+			f, ok := lookup(fields, name)
+			if !ok {
+				c.add(c.missing, endpoint, fieldKey{owner, name}, kind(value), path+"."+name)
+				continue
+			}
+			fk := fieldKey{owner, f.name}
+			c.seen[fk] = true
+			c.walk(endpoint, value, f.typ, childOwner(f.typ, owner, f.name), fk, path+"."+name)
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			c.expect(endpoint, v, "string", t, key, path) // []byte is base64.
+			return
+		}
+		array, ok := v.([]interface{})
+		if !ok {
+			c.mismatch(endpoint, v, t, key, path)
+			return
+		}
+		for _, value := range array {
+			c.walk(endpoint, value, t.Elem(), childOwner(t.Elem(), owner, ""), key, path+"[]")
+		}
+	case reflect.Map:
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			c.mismatch(endpoint, v, t, key, path)
+			return
+		}
+		for name, value := range object {
+			c.walk(endpoint, value, t.Elem(), childOwner(t.Elem(), owner, "*"), key, path+"."+name)
+		}
+	case reflect.String:
+		c.expect(endpoint, v, "string", t, key, path)
+	case reflect.Bool:
+		c.expect(endpoint, v, "bool", t, key, path)
+	case reflect.Float32, reflect.Float64:
+		c.expect(endpoint, v, "number", t, key, path)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := v.(json.Number)
+		if !ok {
+			c.mismatch(endpoint, v, t, key, path)
+		} else if _, err := n.Int64(); err != nil {
+			c.add(c.mismatches, endpoint, key, "got float "+n.String()+", declared "+t.String(), path)
+		}
+	}
+}
+
+// expect records a mismatch unless v is of the given JSON kind.
+func (c *checker) expect(endpoint string, v interface{}, want string, t reflect.Type, key fieldKey, path string) {
+	if kind(v) != want {
+		c.mismatch(endpoint, v, t, key, path)
+	}
+}
+
+// mismatch records that v can't be decoded into t.
+func (c *checker) mismatch(endpoint string, v interface{}, t reflect.Type, key fieldKey, path string) {
+	c.add(c.mismatches, endpoint, key, "got "+kind(v)+", declared "+t.String(), path)
+}
+
+// add records a finding for key unless there already is one.
+func (c *checker) add(findings map[fieldKey]*finding, endpoint string, key fieldKey, detail, path string) {
+	if key.owner == "" {
+		key.name = "(payload)" // The payload itself isn't a field.
+		key.owner = endpoint
+	}
+	if _, ok := findings[key]; !ok {
+		findings[key] = &finding{key: key, detail: detail, example: endpoint + " " + path}
+	}
+}
+
+// unseen returns the declared fields that weren't present in any payload.
+func (c *checker) unseen() []fieldKey {
+	var keys []fieldKey
+	for k := range c.declared {
+		if !c.seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+// jsonFields returns the fields of the struct t as encoding/json sees them, including
+// the fields of embedded structs.
+func jsonFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, jsonFields(ft)...)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue // Unexported.
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{name: name, typ: ft})
+	}
+	return fields
+}
+
+// lookup finds the field a key decodes into, preferring an exact match like
+// encoding/json does.
+func lookup(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// childOwner names the struct a value of type t is, when it is the field name of owner.
+// Anonymous structs are named by their location.
+func childOwner(t reflect.Type, owner, name string) string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if n := typeName(t); n != "" {
+		return n
+	}
+	if name == "" {
+		return owner
+	}
+	return owner + "." + name
+}
+
+// typeName returns the name of t, without its package, or "" if it has none.
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// kind returns the JSON kind of a decoded value.
+func kind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// sortFindings returns the findings ordered by struct and field.
+func sortFindings(findings map[fieldKey]*finding) []*finding {
+	out := make([]*finding, 0, len(findings))
+	for _, f := range findings {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return less(out[i].key, out[j].key) })
+	return out
+}
+
+func less(a, b fieldKey) bool {
+	if a.owner != b.owner {
+		return a.owner < b.owner
+	}
+	return a.name < b.name
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testGame struct {
+	Id   int64  `json:"id"`
+	Name string `json:"title"`
+}
+
+type testSeries struct {
+	Id      int64       `json:"id"`
+	Title   string      `json:"title"`
+	Start   *time.Time  `json:"start"`
+	Game    testGame    `json:"game"`
+	Scores  map[int]int `json:"scores"`
+	Casters []string    `json:"casters"`
+	Ignored string      `json:"-"`
+	Stats   struct {
+		Kills int64 `json:"kills"`
+	} `json:"stats"`
+}
+
+// keys formats the findings as "owner name detail", sorted.
+func keys(findings map[fieldKey]*finding) []string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, f.key.owner+" "+f.key.name+" "+f.detail)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// names formats field keys as "owner name".
+func names(fks []fieldKey) []string {
+	var out []string
+	for _, k := range fks {
+		out = append(out, k.owner+" "+k.name)
+	}
+	return out
+}
+
+func TestChecker(t *testing.T) {
+	series := reflect.TypeOf(testSeries{})
+
+	tests := []struct {
+		name         string
+		t            reflect.Type
+		payloads     []string
+		wantMissing  []string
+		wantMismatch []string
+		wantUnseen   []string
+	}{
+		{
+			name: "every field",
+			t:    series,
+			payloads: []string{`{
+				"id": 1, "title": "Final", "start": "2026-10-18T12:00:00Z", "game": {"id": 1, "title": "Dota 2"},
+				"scores": {"1": 2}, "casters": ["a"], "stats": {"kills": 10}
+			}`},
+		},
+		{
+			name:        "missing",
+			t:           series,
+			payloads:    []string{`{"id": 1, "title": "Final", "brand_new": {"a": 1}, "game": {"id": 1, "icon": "x"}}`},
+			wantMissing: []string{"testGame icon string", "testSeries brand_new object"},
+			wantUnseen:  []string{"testGame title", "testSeries casters", "testSeries scores", "testSeries start", "testSeries stats"},
+		},
+		{
+			name: "mismatched",
+			t:    series,
+			// time.Time decodes itself, so start isn't reported.
+			payloads: []string{`{
+				"id": 1.5, "title": 2, "start": 3, "game": "dota", "scores": [], "casters": "a", "stats": {"kills": "ten"}
+			}`},
+			wantMismatch: []string{
+				"testSeries casters got string, declared []string",
+				"testSeries game got string, declared main.testGame",
+				"testSeries id got float 1.5, declared int64",
+				"testSeries scores got array, declared map[int]int",
+				"testSeries title got number, declared string",
+				"testSeries.stats kills got string, declared int64",
+			},
+		},
+		{
+			name:     "seen in another payload",
+			t:        series,
+			payloads: []string{`{"id": 1, "title": "a"}`, `{"game": null, "scores": null, "casters": [], "start": null, "stats": {"kills": 1}}`},
+		},
+		{
+			name:         "list",
+			t:            reflect.TypeOf([]testGame{}),
+			payloads:     []string{`[{"id": 1, "title": "a"}, {"id": "2", "title": "b", "extra": true}]`},
+			wantMissing:  []string{"testGame extra bool"},
+			wantMismatch: []string{"testGame id got string, declared int64"},
+		},
+		{
+			name:         "payload of the wrong kind",
+			t:            series,
+			payloads:     []string{`[1, 2]`},
+			wantMismatch: []string{"/v2/test (payload) got array, declared main.testSeries"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newChecker()
+			for _, p := range tt.payloads {
+				if err := c.check("/v2/test", tt.t, []byte(p)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := keys(c.missing); strings.Join(got, "\n") != strings.Join(tt.wantMissing, "\n") {
+				t.Errorf("missing:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(tt.wantMissing, "\n"))
+			}
+			if got := keys(c.mismatches); strings.Join(got, "\n") != strings.Join(tt.wantMismatch, "\n") {
+				t.Errorf("mismatches:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(tt.wantMismatch, "\n"))
+			}
+			if tt.wantMismatch != nil {
+				return // The fields of mismatched values aren't looked at.
+			}
+			if got := names(c.unseen()); strings.Join(got, "\n") != strings.Join(tt.wantUnseen, "\n") {
+				t.Errorf("unseen:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(tt.wantUnseen, "\n"))
+			}
+		})
+	}
+}
+
+func TestCheckInvalidJSON(t *testing.T) {
+	if err := newChecker().check("/v2/test", reflect.TypeOf(testSeries{}), []byte(`{"id":`)); err == nil {
+		t.Fatal("invalid JSON is accepted")
+	}
+}
+
+func TestReport(t *testing.T) {
+	c := newChecker()
+	c.check("/v2/test", reflect.TypeOf(testGame{}), []byte(`{"id": "1", "icon": "x"}`))
+
+	var b strings.Builder
+	failed := report(&b, c, true)
+	if !failed {
+		t.Error("missing fields and mismatches don't fail the report")
+	}
+	for _, want := range []string{"testGame", "missing   icon", "mismatch  id", "unseen    title"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("report doesn't contain %q:\n%s", want, b.String())
+		}
+	}
+
+	c = newChecker()
+	c.check("/v2/test", reflect.TypeOf(testGame{}), []byte(`{"id": 1}`))
+	if report(&strings.Builder{}, c, true) {
+		t.Error("unseen fields fail the report")
+	}
+}
@@ -0,0 +1,91 @@
+package abios
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/PatronGG/abios-go-sdk/internal/route"
+)
+
+// DecodeError is the Err of the ErrorStruct returned when a response can't be decoded,
+// e.g. because the API changed the type of a field. In strict mode it is also returned
+// for fields the structs don't model:
+//
+//	if derr, ok := err.Err.(*abios.DecodeError); ok && derr.Field != "" {
+//		log.Printf("the API added %v to %v", derr.Field, derr.Target)
+//	}
+type DecodeError struct {
+	Endpoint string // The endpoint the response came from.
+	Target   string // The type the response was decoded into, e.g. "structs.SeriesStruct".
+	Field    string // The unknown field, if that is what failed strict decoding.
+	Err      error  // The error from encoding/json.
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("abios: decoding %v from %v: unknown field %q", e.Target, e.Endpoint, e.Field)
+	}
+	return fmt.Sprintf("abios: decoding %v from %v: %v", e.Target, e.Endpoint, e.Err)
+}
+
+// Unwrap returns the error from encoding/json.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Prefix of the error encoding/json returns for unknown fields.
+const unknownFieldPrefix = `json: unknown field "`
+
+// newDecodeError describes the failure to decode the response from endpoint into target.
+func newDecodeError(endpoint string, target interface{}, err error) *DecodeError {
+	derr := &DecodeError{
+		Endpoint: endpoint,
+		Target:   strings.TrimPrefix(fmt.Sprintf("%T", target), "*"),
+		Err:      err,
+	}
+	if msg := err.Error(); strings.HasPrefix(msg, unknownFieldPrefix) {
+		derr.Field = strings.TrimSuffix(strings.TrimPrefix(msg, unknownFieldPrefix), `"`)
+	}
+	return derr
+}
+
+// SetStrictDecoding makes the client fail requests whose responses have fields the
+// structs don't model, with a DecodeError naming the field. It is meant for tests and
+// canaries that should notice API additions early, not for production. Structs that
+// decode themselves, e.g. the winrate statistics, accept unknown fields regardless.
+// Default is false.
+func (a *client) SetStrictDecoding(strict bool) {
+	var v uint32
+	if strict {
+		v = 1
+	}
+	atomic.StoreUint32(&a.handler.strict, v)
+}
+
+// decode decodes the response from endpoint into target within a decode span. If it
+// fails the error is recorded on the call span and returned.
+func (a *client) decode(ctx context.Context, call Span, endpoint string, body []byte, target interface{}) *DecodeError {
+	_, span := a.handler.getTracer().Start(ctx, spanDecode, time.Now(), Attributes{"abios.body_size": len(body)})
+	defer endSpan(span)
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if atomic.LoadUint32(&a.handler.strict) != 0 {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(target)
+	if err == nil {
+		return nil
+	}
+
+	derr := newDecodeError(a.handler.pipeline.urls.resolve(endpoint), target, err)
+	span.RecordError(derr)
+	call.RecordError(derr)
+	a.logger().Warn("Decoding response failed", "endpoint", route.Family(derr.Endpoint),
+		"target", derr.Target, "error", err)
+	return derr
+}
@@ -0,0 +1,100 @@
+package abios
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+func TestNewDecodeError(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		strict    bool
+		wantField string
+	}{
+		{"unknown field", `{"id":1,"brand_new":true}`, true, "brand_new"},
+		{"unknown nested field", `{"id":1,"game":{"id":1,"brand_new":true}}`, true, "brand_new"},
+		{"wrong type", `{"id":"one"}`, false, ""},
+		{"syntax error", `{"id":`, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s SeriesStruct
+			dec := json.NewDecoder(bytes.NewReader([]byte(tt.body)))
+			if tt.strict {
+				dec.DisallowUnknownFields()
+			}
+			err := dec.Decode(&s)
+			if err == nil {
+				t.Fatal("the body decoded")
+			}
+
+			derr := newDecodeError("https://api.abiosgaming.com/v2/series/1", &s, err)
+			if derr.Field != tt.wantField {
+				t.Errorf("Field = %q, want %q", derr.Field, tt.wantField)
+			}
+			if derr.Target != "structs.SeriesStruct" {
+				t.Errorf("Target = %q, want structs.SeriesStruct", derr.Target)
+			}
+			if !errors.Is(derr, err) {
+				t.Errorf("%v doesn't unwrap to %v", derr, err)
+			}
+		})
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	a := newTestClient(t, respond(map[string]response{
+		"/v2/series/1": {200, `{"id":1,"title":"Final"}`},
+		"/v2/series/2": {200, `{"id":2,"brand_new":true}`},
+		"/v2/series/3": {200, `{"id":"three"}`},
+	}))
+
+	tests := []struct {
+		name      string
+		endpoint  string
+		strict    bool
+		wantErr   bool
+		wantField string
+	}{
+		{"known fields", seriesById + "1", false, false, ""},
+		{"known fields, strict", seriesById + "1", true, false, ""},
+		{"unknown field", seriesById + "2", false, false, ""},
+		{"unknown field, strict", seriesById + "2", true, true, "brand_new"},
+		{"wrong type", seriesById + "3", false, true, ""},
+		{"wrong type, strict", seriesById + "3", true, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &lineLogger{}
+			a.SetLogger(l)
+			a.SetStrictDecoding(tt.strict)
+
+			_, err := get[SeriesStruct](context.Background(), a, tt.endpoint, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+
+			var derr *DecodeError
+			if !errors.As(err, &derr) {
+				t.Fatalf("%v isn't a DecodeError", err)
+			}
+			if derr.Field != tt.wantField {
+				t.Errorf("Field = %q, want %q", derr.Field, tt.wantField)
+			}
+			if len(l.lines) != 1 || l.lines[0].level != "warn" || l.lines[0].msg != "Decoding response failed" {
+				t.Errorf("logged %v, want one warning", l.lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package abios
+
+import "errors"
+
+// Errors the SDK fails requests with. They are returned as the Err field of the
+// ErrorStruct, e.g:
+//
+//	if err != nil && err.Err == abios.ErrQueueFull {
+//		// Serve stale data instead.
+//	}
+var (
+	ErrQueueFull     = errors.New("abios: request queue is full")
+	ErrQuotaExceeded = errors.New("abios: request would exceed quota")
+	ErrCircuitOpen   = errors.New("abios: circuit breaker is open")
+)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -21,21 +22,32 @@ func main() {
 		return
 	}
 
+	// Fetch the team_stats of every team playing in one batch instead of one request
+	// per team.
+	var ids []int64
 	for _, s := range series.Data {
 		for _, roster := range s.Rosters {
 			// roster.Teams is either of length 1 or empty.
 			for _, team := range roster.Teams {
-				// Get the team_stats from /teams:id endpoint.
-				parameters.Del("starts_after")
-				parameters.Add("with[]", "team_stats")
-				teamWithStats, err := a.TeamsById(team.Id, parameters)
-				if err != nil {
-					fmt.Println(err)
+				ids = append(ids, team.Id)
+			}
+		}
+	}
+	withStats := make(abios.Parameters)
+	withStats.Add("with[]", "team_stats")
+	teams := a.TeamsByIds(context.Background(), ids, withStats)
+
+	for _, s := range series.Data {
+		for _, roster := range s.Rosters {
+			for _, team := range roster.Teams {
+				teamWithStats := teams[team.Id]
+				if teamWithStats.Err != nil {
+					fmt.Println(teamWithStats.Err)
 					continue
 				}
-				seriesWinrate := teamWithStats.Stats.Winrate.Series
+				seriesWinrate := teamWithStats.Value.TeamStats.Winrate.Series
 				fmt.Printf("%v has a winrate of %.2f%% over %v series in %v and their latest match started %v\n",
-					teamWithStats.Name,
+					teamWithStats.Value.Name,
 					seriesWinrate.Rate*100,
 					seriesWinrate.History,
 					s.Game.LongTitle,
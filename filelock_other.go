@@ -0,0 +1,43 @@
+//go:build !unix
+
+package abios
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Lock files older than this are assumed to be left behind by a crashed process.
+const stale_lock_age = 10 * time.Second
+
+// lockFile takes an exclusive lock on f by creating a lock file next to it, retrying
+// until it succeeds or ctx is done.
+func lockFile(ctx context.Context, f *os.File) error {
+	path := f.Name() + ".lock"
+	for {
+		lock, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			return lock.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > stale_lock_age {
+			os.Remove(path)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// unlockFile releases the lock taken by lockFile.
+func unlockFile(f *os.File) error {
+	return os.Remove(f.Name() + ".lock")
+}
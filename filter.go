@@ -0,0 +1,113 @@
+package abios
+
+import (
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// SeriesFilter decides whether a SeriesMessage received from the push API should be
+// passed on to the application. Filters are applied locally by the push client and can
+// therefore express conditions the push server doesn't support.
+type SeriesFilter func(SeriesMessage) bool
+
+// SetSeriesFilters replaces the local filters applied to messages on the 'series'
+// channel. A message is only delivered if every filter returns true.
+func (a *client) SetSeriesFilters(filters ...SeriesFilter) {
+	a.push.mu.Lock()
+	defer a.push.mu.Unlock()
+	a.push.seriesFilters = filters
+}
+
+// acceptSeries reports whether s passes all local series filters.
+func (a *client) acceptSeries(s SeriesMessage) bool {
+	a.push.mu.Lock()
+	filters := a.push.seriesFilters
+	a.push.mu.Unlock()
+
+	for _, f := range filters {
+		if !f(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// AnyOf returns a SeriesFilter that accepts messages accepted by at least one of the
+// given filters.
+func AnyOf(filters ...SeriesFilter) SeriesFilter {
+	return func(s SeriesMessage) bool {
+		for _, f := range filters {
+			if f(s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TournamentTiers accepts series whose tournament has one of the given tiers. The series
+// tier is used if the payload doesn't include the tournament.
+func TournamentTiers(tiers ...int64) SeriesFilter {
+	return func(s SeriesMessage) bool {
+		state := s.Payload.State
+		for _, tier := range tiers {
+			if state.Tournament.Id != 0 && state.Tournament.Tier == tier {
+				return true
+			}
+			if state.Tournament.Id == 0 && state.Tier != nil && *state.Tier == tier {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TeamIDs accepts series where at least one of the given teams plays.
+func TeamIDs(ids ...int64) SeriesFilter {
+	return func(s SeriesMessage) bool {
+		for _, roster := range s.Payload.State.Rosters {
+			for _, team := range roster.Teams {
+				for _, id := range ids {
+					if team.Id == id {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+}
+
+// Streamed accepts series that are streamed.
+func Streamed() SeriesFilter {
+	return func(s SeriesMessage) bool {
+		return s.Payload.State.Streamed
+	}
+}
+
+// Events accepts messages carrying at least one of the given events, e.g.
+// SeriesPayloadEventScored.
+func Events(events ...string) SeriesFilter {
+	return func(s SeriesMessage) bool {
+		for _, e := range s.Payload.Events {
+			for _, want := range events {
+				if e == want {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// PayloadTypes accepts messages of the given payload types, e.g.
+// SeriesPayloadTypeUpdated.
+func PayloadTypes(types ...string) SeriesFilter {
+	return func(s SeriesMessage) bool {
+		for _, t := range types {
+			if s.Payload.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
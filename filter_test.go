@@ -0,0 +1,54 @@
+package abios
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+func TestSeriesFilters(t *testing.T) {
+	tier := int64(1)
+	message := SeriesMessage{Payload: SeriesPayload{State: SeriesStruct{Id: 7, Tier: &tier}}}
+
+	tests := []struct {
+		name    string
+		filters []SeriesFilter
+		want    bool
+	}{
+		{"none", nil, true},
+		{"tier", []SeriesFilter{TournamentTiers(1, 2)}, true},
+		{"other tier", []SeriesFilter{TournamentTiers(3)}, false},
+		{"all must accept", []SeriesFilter{TournamentTiers(1), TournamentTiers(3)}, false},
+		{"any of", []SeriesFilter{AnyOf(TournamentTiers(3), TournamentTiers(1))}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &client{push: newPushState()}
+			a.SetSeriesFilters(tt.filters...)
+			if got := a.acceptSeries(message); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSeriesFiltersWhileReading(t *testing.T) {
+	a := &client{push: newPushState()}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.SetSeriesFilters(TournamentTiers(int64(i)))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.acceptSeries(SeriesMessage{})
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,108 @@
+package abios
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/uuid"
+)
+
+// Health describes the state of the client, e.g. for readiness probes.
+type Health struct {
+	Ready          bool           `json:"ready"`         // Authenticated and the circuit breaker isn't open.
+	Authenticated  bool           `json:"authenticated"` // False while responses are overridden by a failed authentication.
+	TokenExpiresAt time.Time      `json:"token_expires_at"`
+	QueueDepth     map[string]int `json:"queue_depth"` // Requests waiting per lane.
+	RatePerSecond  int            `json:"rate_per_second"`
+	RatePerMinute  int            `json:"rate_per_minute"`
+	LastSuccessAt  time.Time      `json:"last_success_at"` // Last request answered with a 2xx status.
+	CircuitState   string         `json:"circuit_state"`
+	QuotaError     string         `json:"quota_error,omitempty"` // Why the quota usage couldn't be loaded, if it couldn't.
+	Push           PushHealth     `json:"push"`
+}
+
+// PushHealth describes the connection to the push API.
+type PushHealth struct {
+	Connected      bool      `json:"connected"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	LastMessageAt  time.Time `json:"last_message_at"`
+	LastPongAt     time.Time `json:"last_pong_at"`
+}
+
+// healthState is what Health reports that isn't tracked elsewhere.
+type healthState struct {
+	mu             sync.Mutex
+	tokenExpiresAt time.Time
+	lastSuccessAt  time.Time
+}
+
+// tokenRefreshed records when the new token expires.
+func (h *healthState) tokenRefreshed(expiresIn time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokenExpiresAt = time.Now().Add(expiresIn)
+}
+
+// observe records the time of a successful response.
+func (h *healthState) observe(res result) {
+	if res.statuscode < 200 || 300 <= res.statuscode {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSuccessAt = time.Now()
+}
+
+// Health returns the state of the client.
+func (a *client) Health() Health {
+	circuit := a.CircuitState()
+	h := Health{
+		Authenticated: !a.handler.getOverride().override,
+		QueueDepth:    make(map[string]int, numPriorities),
+		CircuitState:  circuit.String(),
+	}
+
+	a.handler.health.mu.Lock()
+	h.TokenExpiresAt = a.handler.health.tokenExpiresAt
+	h.LastSuccessAt = a.handler.health.lastSuccessAt
+	a.handler.health.mu.Unlock()
+
+	for p, n := range a.handler.queueDepth() {
+		h.QueueDepth[p.String()] = n
+	}
+	h.RatePerSecond, h.RatePerMinute = a.EffectiveRate()
+
+	a.handler.quotas.mu.Lock()
+	if err := a.handler.quotas.loadErr; err != nil {
+		h.QuotaError = err.Error()
+	}
+	a.handler.quotas.mu.Unlock()
+
+	a.push.mu.Lock()
+	h.Push = PushHealth{
+		Connected:      a.push.connected,
+		SubscriptionID: a.push.subscriptionID,
+		LastMessageAt:  a.push.lastMessageAt,
+		LastPongAt:     a.push.lastPongAt,
+	}
+	a.push.mu.Unlock()
+
+	h.Ready = h.Authenticated && circuit != CircuitOpen
+	return h
+}
+
+// HealthHandler returns an http.Handler serving Health as JSON. The status is 200 if
+// the client is ready and 503 otherwise, so it can be used as a readiness probe.
+func (a *client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := a.Health()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !h.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(h)
+	})
+}
@@ -0,0 +1,115 @@
+package abios
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name              string
+		circuit           CircuitState
+		override          bool
+		wantReady         bool
+		wantAuthenticated bool
+	}{
+		{"ready", CircuitClosed, false, true, true},
+		{"half-open is ready", CircuitHalfOpen, false, true, true},
+		{"circuit open", CircuitOpen, false, false, true},
+		{"authentication failed", CircuitClosed, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestClient(t, nil)
+			a.handler.breaker.mu.Lock()
+			a.handler.breaker.state = tt.circuit
+			a.handler.breaker.openedAt = time.Now()
+			a.handler.breaker.mu.Unlock()
+			if tt.override {
+				a.handler.setOverride(responseOverride{override: true, data: result{}})
+			}
+
+			h := a.Health()
+			if h.Ready != tt.wantReady {
+				t.Errorf("Ready = %v, want %v", h.Ready, tt.wantReady)
+			}
+			if h.Authenticated != tt.wantAuthenticated {
+				t.Errorf("Authenticated = %v, want %v", h.Authenticated, tt.wantAuthenticated)
+			}
+			if h.CircuitState != tt.circuit.String() {
+				t.Errorf("CircuitState = %q, want %q", h.CircuitState, tt.circuit.String())
+			}
+			if h.TokenExpiresAt.Before(time.Now().Add(59 * time.Minute)) {
+				t.Errorf("TokenExpiresAt = %v, want an hour from now", h.TokenExpiresAt)
+			}
+			if len(h.QueueDepth) != numPriorities {
+				t.Errorf("QueueDepth = %v, want a depth per lane", h.QueueDepth)
+			}
+			if h.RatePerSecond != 1000 || h.RatePerMinute != 60000 {
+				t.Errorf("rate = %d/%d, want 1000/60000", h.RatePerSecond, h.RatePerMinute)
+			}
+		})
+	}
+}
+
+func TestHealthConcurrentOverride(t *testing.T) {
+	a := newTestClient(t, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.handler.setOverride(responseOverride{override: i%2 == 0})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		a.Health()
+	}
+	wg.Wait()
+}
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		override   bool
+		wantStatus int
+	}{
+		{"ready", false, http.StatusOK},
+		{"not ready", true, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestClient(t, nil)
+			if tt.override {
+				a.handler.setOverride(responseOverride{override: true})
+			}
+
+			rec := httptest.NewRecorder()
+			a.HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var h Health
+			if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if h.Ready != !tt.override || h.Authenticated != !tt.override {
+				t.Errorf("got ready %v, authenticated %v, want %v", h.Ready, h.Authenticated, !tt.override)
+			}
+			if h.CircuitState != CircuitClosed.String() {
+				t.Errorf("CircuitState = %q, want %q", h.CircuitState, CircuitClosed.String())
+			}
+		})
+	}
+}
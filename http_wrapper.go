@@ -1,57 +1,51 @@
 package abios
 
 import (
+	"context"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
-	"net/url"
-	"time"
 )
 
-// performRequest creates the request, sends it and return the response's statuscode along
-// with the response's body.
-func performRequest(targetUrl string, params Parameters) (int, []byte) {
-	u, err := url.Parse(targetUrl)
+// performRequest creates the request, sends it through the middleware chain and return
+// the response's statuscode along with the response's body and headers.
+func (p *pipeline) performRequest(ctx context.Context, targetUrl string, params Parameters) result {
+	req, err := p.newRequest(ctx, "GET", targetUrl, params, nil)
 	if err != nil {
-		// Return something that looks similar to Abios API errors.
-		errData := []byte(`
-			{
-				"error": "application error when parsing URL",
-				"error_code": 0,
-				"error_description": "` + err.Error() + `"
-			}
-		`)
-		return 0, errData
+		return errorResult("when parsing URL", err)
 	}
+	req.HTTP.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	u.RawQuery = params.encode()
-
-	httpReq := &http.Request{
-		Method: "GET",
-		URL:    u,
-		Header: http.Header{
-			"Content-Type": {"application/x-www-form-urlencoded"},
-		},
+	resp, err := p.do(req)
+	if err != nil {
+		res := errorResult("when attempting to perform HTTP request", err)
+		res.transport = true
+		return res
 	}
-
-	return apiCall(httpReq)
+	return result{statuscode: resp.StatusCode, body: resp.Body, header: resp.Header}
 }
 
-// apiCall performs the actual http request and returns the resulting statuscode and body.
-func apiCall(req *http.Request) (int, []byte) {
-	client := &http.Client{Timeout: 20 * time.Second}
+// apiCall performs the actual http request and returns the resulting statuscode, body and
+// headers. It bypasses the middleware chain.
+func apiCall(client *http.Client, req *http.Request) result {
 	resp, err := client.Do(req)
 	if err != nil {
-		// Return something that looks similar to Abios API errors.
-		errData := []byte(`
-			{
-				"error": "application error when attempting to perform HTTP request",
-				"error_code": 0,
-				"error_description": "` + err.Error() + `"
-			}
-		`)
-		return 0, errData
+		res := errorResult("when attempting to perform HTTP request", redactError(err))
+		res.transport = true
+		return res
 	}
 	defer resp.Body.Close()
 	body, _ := ioutil.ReadAll(resp.Body)
-	return resp.StatusCode, body
+	return result{statuscode: resp.StatusCode, body: body, header: resp.Header}
+}
+
+// applicationError returns something that looks similar to Abios API errors for an
+// error that happened within the SDK.
+func applicationError(description string, err error) []byte {
+	errData, _ := json.Marshal(map[string]interface{}{
+		"error":             "application error: " + description,
+		"error_code":        0,
+		"error_description": err.Error(),
+	})
+	return errData
 }
@@ -0,0 +1,31 @@
+// Package route groups the endpoints of the Abios APIs, so that requests to the same
+// endpoint share metric labels and can be looked up regardless of the IDs they carry.
+package route
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gobuffalo/uuid"
+)
+
+// Family returns the path of endpoint with IDs replaced by ":id", e.g.
+// "/v2/series/:id". endpoint may be a URL or only a path. "unknown" is returned if it
+// can't be parsed.
+func Family(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "unknown"
+	}
+
+	segments := strings.Split(strings.TrimSuffix(u.Path, "/"), "/")
+	for i, s := range segments {
+		if _, err := strconv.Atoi(s); err == nil {
+			segments[i] = ":id"
+		} else if _, err := uuid.FromString(s); err == nil {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
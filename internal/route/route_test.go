@@ -0,0 +1,26 @@
+package route
+
+import "testing"
+
+func TestFamily(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"https://api.abiosgaming.com/v2/series", "/v2/series"},
+		{"https://api.abiosgaming.com/v2/series/", "/v2/series"},
+		{"https://api.abiosgaming.com/v2/series/1234", "/v2/series/:id"},
+		{"https://api.abiosgaming.com/v2/series/1234/postgame", "/v2/series/:id/postgame"},
+		{"https://api.abiosgaming.com/v2/series?page=2", "/v2/series"},
+		{"https://hermes.abiosgaming.com/v0/subscription/8a8c0e6a-4b1e-4a31-9a4f-0bf9d7e5f3a1", "/v0/subscription/:id"},
+		{"/v2/teams/99", "/v2/teams/:id"},
+		{"/v2/teams/99/", "/v2/teams/:id"},
+		{"://bad", "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := Family(tt.endpoint); got != tt.want {
+			t.Errorf("Family(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package subscription holds the rules for reconciling push subscriptions, so that the
+// client and the fake in abiostest apply the same ones.
+package subscription
+
+import "github.com/PatronGG/abios-go-sdk/structs"
+
+// Pick returns the subscription in subs to keep for desired, and the other
+// subscriptions with the same name, which are to be deleted. The first up to date
+// subscription is kept, or the first with the name if none is. found is false if no
+// subscription has the name.
+func Pick(subs []structs.Subscription, desired structs.Subscription) (keep structs.Subscription, duplicates []structs.Subscription, found bool) {
+	var named []structs.Subscription
+	for _, sub := range subs {
+		if sub.Name == desired.Name {
+			named = append(named, sub)
+		}
+	}
+	if len(named) == 0 {
+		return structs.Subscription{}, nil, false
+	}
+
+	kept := 0
+	for i, sub := range named {
+		if UpToDate(sub, desired) {
+			kept = i
+			break
+		}
+	}
+	for i, sub := range named {
+		if i != kept {
+			duplicates = append(duplicates, sub)
+		}
+	}
+	return named[kept], duplicates, true
+}
+
+// UpToDate reports whether existing has the description and filters of desired.
+func UpToDate(existing, desired structs.Subscription) bool {
+	return existing.Description == desired.Description && SameFilters(existing.Filters, desired.Filters)
+}
+
+// SameFilters reports whether the two lists contain the same filters, regardless of
+// order.
+func SameFilters(a, b []structs.SubscriptionFilter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := make(map[structs.SubscriptionFilter]int)
+	for _, f := range a {
+		counts[f]++
+	}
+	for _, f := range b {
+		if counts[f] == 0 {
+			return false
+		}
+		counts[f]--
+	}
+
+	return true
+}
@@ -0,0 +1,62 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/PatronGG/abios-go-sdk/structs"
+)
+
+func TestSameFilters(t *testing.T) {
+	one := structs.SubscriptionFilter{Channel: "series", GameID: 1}
+	two := structs.SubscriptionFilter{Channel: "series", GameID: 2}
+
+	tests := []struct {
+		name string
+		a, b []structs.SubscriptionFilter
+		want bool
+	}{
+		{"both empty", nil, nil, true},
+		{"same order", []structs.SubscriptionFilter{one, two}, []structs.SubscriptionFilter{one, two}, true},
+		{"other order", []structs.SubscriptionFilter{one, two}, []structs.SubscriptionFilter{two, one}, true},
+		{"different length", []structs.SubscriptionFilter{one}, []structs.SubscriptionFilter{one, two}, false},
+		{"duplicates differ", []structs.SubscriptionFilter{one, one}, []structs.SubscriptionFilter{one, two}, false},
+	}
+
+	for _, tt := range tests {
+		if got := SameFilters(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	desired := structs.Subscription{Name: "scores", Filters: []structs.SubscriptionFilter{{Channel: "series"}}}
+	stale := structs.Subscription{Name: "scores", Description: "old"}
+	other := structs.Subscription{Name: "odds"}
+
+	tests := []struct {
+		name           string
+		subs           []structs.Subscription
+		wantKeep       int // Index in subs, -1 if none is found.
+		wantDuplicates int
+	}{
+		{"none", []structs.Subscription{other}, -1, 0},
+		{"one stale", []structs.Subscription{other, stale}, 1, 0},
+		{"up to date after stale", []structs.Subscription{stale, other, desired}, 2, 1},
+		{"several stale", []structs.Subscription{stale, stale}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		keep, duplicates, found := Pick(tt.subs, desired)
+		if found != (tt.wantKeep >= 0) {
+			t.Errorf("%s: found = %v", tt.name, found)
+			continue
+		}
+		if found && keep.Description != tt.subs[tt.wantKeep].Description {
+			t.Errorf("%s: kept %+v, want %+v", tt.name, keep, tt.subs[tt.wantKeep])
+		}
+		if len(duplicates) != tt.wantDuplicates {
+			t.Errorf("%s: got %d duplicates, want %d", tt.name, len(duplicates), tt.wantDuplicates)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package abios
+
+import (
+	"sync"
+	"time"
+)
+
+// Names of the histograms push latency is reported as. Values are in seconds.
+const (
+	metricPushLatency      = "abios_push_latency_seconds"       // Labels: channel
+	metricPushEventLatency = "abios_push_event_latency_seconds" // Labels: channel, event
+)
+
+const (
+	// Number of recent samples the clock skew is estimated from.
+	latency_skew_window = 100
+
+	// Minimum time between two warnings about exceeding the latency SLO.
+	latency_warn_interval = time.Minute
+)
+
+// latencyTracker measures the time from when Abios created a push message until we
+// received it.
+//
+// The local clock and the Abios clock are rarely perfectly in sync. Since no message can
+// arrive before it was created, the smallest raw latency among recent samples being
+// negative means our clock is behind by at least that much. Latencies are corrected by
+// that amount. A clock that is ahead can't be told apart from actual delay and is
+// therefore not corrected.
+type latencyTracker struct {
+	mu         sync.Mutex
+	window     []time.Duration // Ring buffer of recent raw latencies.
+	next       int             // Next position to write in window.
+	skew       time.Duration   // Estimated offset of the local clock, 0 or negative.
+	slo        time.Duration   // Latency above which we warn. 0 disables warnings.
+	lastWarn   time.Time
+	suppressed int // Number of SLO violations since the last warning.
+}
+
+// newLatencyTracker returns a latencyTracker without an SLO.
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		window: make([]time.Duration, 0, latency_skew_window),
+	}
+}
+
+// SetPushLatencySLO sets the end-to-end latency above which a warning is logged. A value
+// less than or equal to 0 disables the warnings.
+func (a *client) SetPushLatencySLO(slo time.Duration) {
+	a.latency.mu.Lock()
+	defer a.latency.mu.Unlock()
+	if slo < 0 {
+		slo = 0
+	}
+	a.latency.slo = slo
+}
+
+// PushClockSkew returns how far the local clock is estimated to be behind the Abios
+// clock, as a negative duration. 0 means no skew has been detected.
+func (a *client) PushClockSkew() time.Duration {
+	a.latency.mu.Lock()
+	defer a.latency.mu.Unlock()
+	return a.latency.skew
+}
+
+// recordLatency reports the latency of a message created at created (as given by the
+// created_timestamp field) and received at receivedAt.
+func (a *client) recordLatency(channel string, events []string, created int64, receivedAt time.Time) {
+	if created <= 0 {
+		return
+	}
+
+	latency := a.latency.observe(receivedAt.Sub(createdTime(created)), receivedAt, a.logger())
+	seconds := latency.Seconds()
+
+	a.handler.getMetrics().Observe(metricPushLatency, seconds, Labels{"channel": channel})
+	for _, event := range events {
+		a.handler.getMetrics().Observe(metricPushEventLatency, seconds, Labels{"channel": channel, "event": event})
+	}
+}
+
+// observe adds a raw latency sample and returns it corrected for clock skew.
+func (l *latencyTracker) observe(raw time.Duration, now time.Time, logger Logger) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.window) < latency_skew_window {
+		l.window = append(l.window, raw)
+	} else {
+		l.window[l.next] = raw
+	}
+	l.next = (l.next + 1) % latency_skew_window
+
+	min := l.window[0]
+	for _, d := range l.window[1:] {
+		if d < min {
+			min = d
+		}
+	}
+	l.skew = 0
+	if min < 0 {
+		l.skew = min
+	}
+
+	latency := raw - l.skew
+
+	if 0 < l.slo && l.slo < latency {
+		if now.Sub(l.lastWarn) < latency_warn_interval {
+			l.suppressed++
+		} else {
+			logger.Warn("Push latency exceeds SLO",
+				"latency", latency, "slo", l.slo, "suppressed", l.suppressed)
+			l.lastWarn = now
+			l.suppressed = 0
+		}
+	}
+
+	return latency
+}
+
+// createdTime converts a created_timestamp to a time.Time. The timestamp is interpreted
+// as milliseconds if it is too large to be seconds since the epoch.
+func createdTime(ts int64) time.Time {
+	if ts > 1e12 {
+		return time.Unix(0, ts*int64(time.Millisecond))
+	}
+	return time.Unix(ts, 0)
+}
@@ -0,0 +1,141 @@
+package abios
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencySkew(t *testing.T) {
+	fill := func(n int, d time.Duration) []time.Duration {
+		samples := make([]time.Duration, n)
+		for i := range samples {
+			samples[i] = d
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name     string
+		samples  []time.Duration
+		wantSkew time.Duration
+		wantLast time.Duration // Corrected latency of the last sample.
+	}{
+		{"clocks in sync", []time.Duration{200 * time.Millisecond, 100 * time.Millisecond}, 0, 100 * time.Millisecond},
+		{"clock behind", []time.Duration{-2 * time.Second, -time.Second}, -2 * time.Second, time.Second},
+		{"minimum of the window", []time.Duration{-time.Second, -3 * time.Second, 500 * time.Millisecond}, -3 * time.Second, 3500 * time.Millisecond},
+		{"window is full", append([]time.Duration{-3 * time.Second}, fill(latency_skew_window-1, time.Second)...), -3 * time.Second, 4 * time.Second},
+		{"oldest sample forgotten", append([]time.Duration{-3 * time.Second}, fill(latency_skew_window, time.Second)...), 0, time.Second},
+		{"clock ahead isn't corrected", []time.Duration{5 * time.Second}, 0, 5 * time.Second},
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLatencyTracker()
+			var last time.Duration
+			for _, raw := range tt.samples {
+				last = l.observe(raw, now, nopLogger{})
+			}
+			if l.skew != tt.wantSkew {
+				t.Errorf("skew = %v, want %v", l.skew, tt.wantSkew)
+			}
+			if last != tt.wantLast {
+				t.Errorf("latency = %v, want %v", last, tt.wantLast)
+			}
+			if len(l.window) > latency_skew_window {
+				t.Errorf("window holds %d samples, want at most %d", len(l.window), latency_skew_window)
+			}
+		})
+	}
+}
+
+func TestCreatedTime(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   int64
+		want time.Time
+	}{
+		{"seconds", 1760788800, time.Unix(1760788800, 0)},
+		{"milliseconds", 1760788800123, time.Unix(1760788800, 123*int64(time.Millisecond))},
+		{"largest seconds", 1e12, time.Unix(1e12, 0)},
+		{"smallest milliseconds", 1e12 + 1, time.Unix(1e9, int64(time.Millisecond))},
+		{"seconds far in the future", 9999999999, time.Unix(9999999999, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := createdTime(tt.ts); !got.Equal(tt.want) {
+				t.Errorf("createdTime(%d) = %v, want %v", tt.ts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencySLOWarning(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	l := newLatencyTracker()
+	l.slo = time.Second
+	logger := &lineLogger{}
+
+	samples := []struct {
+		at             time.Duration // Since start.
+		raw            time.Duration
+		wantWarnings   int
+		wantSuppressed int
+	}{
+		{0, 2 * time.Second, 1, 0},
+		{10 * time.Second, 3 * time.Second, 1, 1},
+		{20 * time.Second, 500 * time.Millisecond, 1, 1}, // Within the SLO.
+		{30 * time.Second, 2 * time.Second, 1, 2},
+		{latency_warn_interval, 2 * time.Second, 2, 0},
+		{latency_warn_interval + time.Second, 2 * time.Second, 2, 1},
+	}
+
+	for i, s := range samples {
+		l.observe(s.raw, start.Add(s.at), logger)
+		if len(logger.lines) != s.wantWarnings {
+			t.Fatalf("sample %d: %d warnings, want %d", i, len(logger.lines), s.wantWarnings)
+		}
+		if l.suppressed != s.wantSuppressed {
+			t.Fatalf("sample %d: %d suppressed, want %d", i, l.suppressed, s.wantSuppressed)
+		}
+	}
+
+	second := logger.lines[1]
+	if second.level != "warn" || second.msg != "Push latency exceeds SLO" {
+		t.Errorf("logged %s %q", second.level, second.msg)
+	}
+	if got := second.arg("suppressed"); got != 2 {
+		t.Errorf("suppressed = %v, want 2", got)
+	}
+	if got := second.arg("latency"); got != 2*time.Second {
+		t.Errorf("latency = %v, want 2s", got)
+	}
+}
+
+func TestRecordLatency(t *testing.T) {
+	m := &recordingMetrics{}
+	a := &client{handler: newTestHandler(), latency: newLatencyTracker()}
+	a.handler.metrics = m
+	receivedAt := time.Unix(1760788801, 0)
+
+	a.recordLatency("series", nil, 0, receivedAt)
+	if len(m.observations) != 0 {
+		t.Fatalf("a message without created_timestamp is observed: %v", m.observations)
+	}
+
+	a.recordLatency("series", []string{"scored", "ended"}, 1760788800000, receivedAt)
+	want := []observation{
+		{metricPushLatency, 1, Labels{"channel": "series"}},
+		{metricPushEventLatency, 1, Labels{"channel": "series", "event": "scored"}},
+		{metricPushEventLatency, 1, Labels{"channel": "series", "event": "ended"}},
+	}
+	if len(m.observations) != len(want) {
+		t.Fatalf("got observations %v, want %v", m.observations, want)
+	}
+	for i, o := range m.observations {
+		if o.name != want[i].name || o.value != want[i].value || o.labels["channel"] != want[i].labels["channel"] || o.labels["event"] != want[i].labels["event"] {
+			t.Errorf("observation %d = %v, want %v", i, o, want[i])
+		}
+	}
+}
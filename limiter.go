@@ -0,0 +1,127 @@
+package abios
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter decides when the next request may be sent. A Limiter can be shared between
+// several clients (see SetLimiter) so that together they stay within the rate limits of
+// the account. Implementations must be safe for concurrent use.
+type Limiter interface {
+	// Wait blocks until a request may be sent, or returns an error if ctx is done first.
+	Wait(ctx context.Context) error
+}
+
+// rateLimiter is implemented by limiters whose rate can be changed through SetRate.
+type rateLimiter interface {
+	Limiter
+	SetRate(second, minute int)
+	Rate() (second, minute int)
+}
+
+// RateLimiter is an in-process Limiter that allows a number of requests per second and
+// per minute. Requests are let through as soon as possible, i.e they are not spread out
+// evenly within the second or minute.
+type RateLimiter struct {
+	mu     sync.Mutex
+	second int
+	minute int
+	sent   []time.Time // When requests were let through during the last minute.
+}
+
+// NewLimiter returns a RateLimiter allowing second requests per second and minute
+// requests per minute.
+func NewLimiter(second, minute int) *RateLimiter {
+	l := &RateLimiter{
+		second: default_requests_per_second,
+		minute: default_requests_per_minute,
+	}
+	l.SetRate(second, minute)
+	return l
+}
+
+// SetRate sets the allowed rate. A value less than or equal to 0 means the previous
+// value is kept.
+func (l *RateLimiter) SetRate(second, minute int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if 0 < second {
+		l.second = second
+	}
+
+	if 0 < minute {
+		l.minute = minute
+	}
+
+	// Make sure they are consistent
+	if l.second > l.minute {
+		l.second = l.minute
+	}
+}
+
+// Rate returns the allowed rate.
+func (l *RateLimiter) Rate() (second, minute int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.second, l.minute
+}
+
+// Wait blocks until sending a request keeps us within the rate.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		wait := l.reserve(time.Now())
+		if wait == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve records a request sent at now and returns 0 if that is within the rate.
+// Otherwise nothing is recorded and the time until it may be is returned.
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget requests older than a minute.
+	i := 0
+	for i < len(l.sent) && now.Sub(l.sent[i]) >= time.Minute {
+		i++
+	}
+	l.sent = l.sent[i:]
+
+	if len(l.sent) >= l.minute {
+		return l.sent[len(l.sent)-l.minute].Add(time.Minute).Sub(now)
+	}
+
+	if n := len(l.sent); n >= l.second {
+		oldest := l.sent[n-l.second]
+		if now.Sub(oldest) < time.Second {
+			return oldest.Add(time.Second).Sub(now)
+		}
+	}
+
+	l.sent = append(l.sent, now)
+	return 0
+}
+
+// SetLimiter makes the client wait for l before sending each request. Give several
+// clients the same Limiter, e.g. from NewLimiter or NewSharedLimiter, to make them share
+// the rate limits of one account. SetRate changes the rate of l if l is a RateLimiter or
+// a SharedLimiter. nil restores a limiter of its own with the default rate.
+func (a *client) SetLimiter(l Limiter) {
+	if l == nil {
+		l = NewLimiter(default_requests_per_second, default_requests_per_minute)
+	}
+	a.handler.setLimiter(l)
+}
@@ -0,0 +1,101 @@
+package abios
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		sent     []time.Duration // How long ago requests were let through.
+		wantWait time.Duration
+	}{
+		{"idle", nil, 0},
+		{"within the second", []time.Duration{500 * time.Millisecond}, 0},
+		{"second full", []time.Duration{800 * time.Millisecond, 600 * time.Millisecond}, 200 * time.Millisecond},
+		{"second passed", []time.Duration{1500 * time.Millisecond, 1200 * time.Millisecond}, 0},
+		{"minute full", []time.Duration{50 * time.Second, 40 * time.Second, 30 * time.Second}, 10 * time.Second},
+		{"minute passed", []time.Duration{70 * time.Second, 40 * time.Second, 30 * time.Second}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(2, 3)
+			for _, ago := range tt.sent {
+				l.sent = append(l.sent, now.Add(-ago))
+			}
+			before := len(l.sent)
+
+			if wait := l.reserve(now); wait != tt.wantWait {
+				t.Fatalf("got wait %v, want %v", wait, tt.wantWait)
+			}
+			if tt.wantWait != 0 && len(l.sent) != before {
+				t.Fatal("a request that has to wait was recorded")
+			}
+		})
+	}
+}
+
+func TestSharedLimiterReserve(t *testing.T) {
+	now := time.Now()
+	grant := func(replica string, ago time.Duration) Grant { return Grant{Replica: replica, At: now.Add(-ago)} }
+	tests := []struct {
+		name     string
+		grants   []Grant
+		wantWait time.Duration
+		wantKept int // Grants stored afterwards.
+	}{
+		{"alone", nil, 0, 1},
+		{"alone with the whole rate", []Grant{grant("self", 300*time.Millisecond), grant("self", 200*time.Millisecond), grant("self", 100*time.Millisecond)}, 0, 4},
+		{"old grants dropped", []Grant{grant("other", 2*time.Minute)}, 0, 1},
+		{"share used up", []Grant{grant("self", 400*time.Millisecond), grant("self", 300*time.Millisecond), grant("other", 100*time.Millisecond)}, 600 * time.Millisecond, 3},
+		{"total used up", []Grant{grant("other", 900*time.Millisecond), grant("other", 800*time.Millisecond), grant("other", 700*time.Millisecond), grant("other", 600*time.Millisecond)}, 100 * time.Millisecond, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewSharedLimiter(nil, 4, 100)
+			l.replica = "self"
+
+			kept, wait := l.reserve(tt.grants, now, 4, 100)
+			if wait != tt.wantWait {
+				t.Errorf("got wait %v, want %v", wait, tt.wantWait)
+			}
+			if len(kept) != tt.wantKept {
+				t.Errorf("got %d grants, want %d", len(kept), tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestFileStoreSerializesUpdates(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "grants.json"))
+
+	const updates = 20
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Update(context.Background(), func(grants []Grant) []Grant {
+				return append(grants, Grant{Replica: "r", At: time.Now()})
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	store.Update(context.Background(), func(grants []Grant) []Grant {
+		if len(grants) != updates {
+			t.Errorf("got %d grants, want %d: updates interleaved", len(grants), updates)
+		}
+		return grants
+	})
+}
@@ -0,0 +1,121 @@
+package abios
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// Logger receives the log output of the SDK. The methods have the same shape as those
+// of *slog.Logger, which can be used as a Logger directly: msg describes the event and
+// args are alternating keys and values, e.g. "subscription_id", id. Implementations must
+// be safe for concurrent use.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// nopLogger discards all output. It is used until SetLogger is called.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// stdLogger is a Logger writing through a *log.Logger.
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger returns a Logger writing lines like "[INFO]: msg key=value" to l, or to
+// the standard logger if l is nil.
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return stdLogger{l: l}
+}
+
+func (s stdLogger) Debug(msg string, args ...interface{}) { s.print("DEBUG", msg, args) }
+func (s stdLogger) Info(msg string, args ...interface{})  { s.print("INFO", msg, args) }
+func (s stdLogger) Warn(msg string, args ...interface{})  { s.print("WARN", msg, args) }
+func (s stdLogger) Error(msg string, args ...interface{}) { s.print("ERROR", msg, args) }
+
+// print writes a line with the level, the message and the fields.
+func (s stdLogger) print(level, msg string, args []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]: %s", level, msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	s.l.Println(b.String())
+}
+
+// SetLogger sets where the SDK writes its log output. nil disables logging, which is the
+// default. Tokens are always redacted from logged URLs and parameters.
+func (a *client) SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	a.handler.hooksMu.Lock()
+	a.handler.logger = l
+	a.handler.hooksMu.Unlock()
+	a.handler.quotas.setLogger(l)
+	a.handler.adaptive.mu.Lock()
+	a.handler.adaptive.logger = l
+	a.handler.adaptive.mu.Unlock()
+}
+
+// logger returns the Logger set by SetLogger.
+func (a *client) logger() Logger {
+	return a.handler.getLogger()
+}
+
+// Parameters that carry credentials and must never be logged.
+var secretParams = []string{"access_token", "reconnect_token", "client_secret"}
+
+// Replaces the value of a secret parameter when logged.
+const redacted = "REDACTED"
+
+// redactParams returns a copy of params with the values of secret parameters replaced.
+func redactParams(params Parameters) Parameters {
+	out := make(Parameters, len(params))
+	for key, values := range params {
+		out[key] = values
+	}
+	for _, key := range secretParams {
+		if _, ok := out[key]; ok {
+			out[key] = []string{redacted}
+		}
+	}
+	return out
+}
+
+// redactURL returns u as a string with the values of secret query parameters replaced.
+func redactURL(u *url.URL) string {
+	c := *u
+	c.RawQuery = redactParams(Parameters(u.Query())).encode()
+	return c.String()
+}
+
+// redactError returns err with the values of secret query parameters replaced in the URL
+// of a *url.Error, which the http client returns with the full request URL.
+func redactError(err error) error {
+	uerr, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	u, perr := url.Parse(uerr.URL)
+	if perr != nil {
+		return err
+	}
+	return &url.Error{Op: uerr.Op, URL: redactURL(u), Err: uerr.Err}
+}
@@ -0,0 +1,60 @@
+package abios
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRedactError(t *testing.T) {
+	cause := errors.New("connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"token", &url.Error{Op: "Get", URL: "https://api.abiosgaming.com/v2/series?access_token=secret&page=2", Err: cause},
+			`Get "https://api.abiosgaming.com/v2/series?access_token=REDACTED&page=2": connection refused`},
+		{"no query", &url.Error{Op: "Get", URL: "https://api.abiosgaming.com/v2/series", Err: cause},
+			`Get "https://api.abiosgaming.com/v2/series": connection refused`},
+		{"other error", cause, "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := redactError(tt.err)
+			if err.Error() != tt.want {
+				t.Errorf("got %q, want %q", err.Error(), tt.want)
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("token leaked: %q", err.Error())
+			}
+			if !errors.Is(err, cause) {
+				t.Errorf("cause lost: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetLoggerWhileLogging(t *testing.T) {
+	a := &client{handler: newTestHandler()}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.SetLogger(NewStdLogger(log.New(ioutil.Discard, "", 0)))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.logger().Info("Request done")
+		}
+	}()
+	wg.Wait()
+}
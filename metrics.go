@@ -0,0 +1,43 @@
+package abios
+
+// Labels adds dimensions, e.g. the push channel, to a metric sample.
+type Labels map[string]string
+
+// Metrics receives measurements from the SDK. Implementations must be safe for
+// concurrent use. PrometheusMetrics is an implementation that can be scraped by
+// Prometheus.
+type Metrics interface {
+	// Observe records value in the histogram called name.
+	Observe(name string, value float64, labels Labels)
+	// Add adds delta to the counter called name.
+	Add(name string, delta float64, labels Labels)
+	// Set sets the gauge called name to value.
+	Set(name string, value float64, labels Labels)
+}
+
+// Metrics reported by the client itself. The request handler, pipeline and push client
+// declare their own next to where they are measured.
+const (
+	metricTokenRefreshes = "abios_token_refreshes_total" // Labels: result
+	metricRetries        = "abios_retries_total"         // Labels: operation
+	metricPushReconnects = "abios_push_reconnects_total" // Labels: reason
+	metricPushMessages   = "abios_push_messages_total"   // Labels: channel
+)
+
+// nopMetrics discards all measurements. It is used until SetMetrics is called.
+type nopMetrics struct{}
+
+func (nopMetrics) Observe(name string, value float64, labels Labels) {}
+func (nopMetrics) Add(name string, delta float64, labels Labels)     {}
+func (nopMetrics) Set(name string, value float64, labels Labels)     {}
+
+// SetMetrics sets where the SDK reports its measurements. nil disables reporting.
+func (a *client) SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	a.handler.hooksMu.Lock()
+	a.handler.metrics = m
+	a.handler.hooksMu.Unlock()
+	a.handler.pipeline.setMetrics(m)
+}
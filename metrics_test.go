@@ -0,0 +1,25 @@
+package abios
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetMetricsWhileReporting(t *testing.T) {
+	a := &client{handler: newTestHandler()}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.SetMetrics(NewPrometheusMetrics())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.handler.reportQueueDepth()
+		}
+	}()
+	wg.Wait()
+}
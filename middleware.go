@@ -0,0 +1,239 @@
+package abios
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PatronGG/abios-go-sdk/internal/route"
+)
+
+// Request is a request on its way to the Abios API.
+type Request struct {
+	Endpoint string        // The URL of the endpoint without query, e.g. ".../v2/series/1234".
+	Params   Parameters    // The query parameters, including the access token.
+	HTTP     *http.Request // The request that will be sent, with Params encoded in its URL.
+}
+
+// Response is the response of the Abios API to a Request.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Handler sends a Request and returns the Response. An error means no response was
+// received, e.g. because of a network error.
+type Handler func(req *Request) (*Response, error)
+
+// Middleware wraps a Handler, e.g. to change requests before they are sent or to
+// inspect responses. A Middleware may also answer a request without calling next.
+type Middleware func(next Handler) Handler
+
+// Default timeout of the http client used to send requests.
+const default_http_timeout = 20 * time.Second
+
+const metricHTTPRequest = "abios_http_request_seconds" // Labels: method, endpoint, status
+
+// pipeline sends requests through the middleware chain and finally the http client.
+type pipeline struct {
+	mu         sync.RWMutex
+	middleware []Middleware
+	client     *http.Client
+	metrics    Metrics
+	urls       baseURLs // Set by the options given to New, not changed afterwards.
+	chain      Handler  // The middleware applied to send, rebuilt when either changes.
+}
+
+// newPipeline returns a pipeline without middleware using a default http client.
+func newPipeline() *pipeline {
+	p := &pipeline{
+		client:  &http.Client{Timeout: default_http_timeout},
+		metrics: nopMetrics{},
+		urls:    defaultBaseURLs(),
+	}
+	p.build()
+	return p
+}
+
+// build applies the middleware to send. The request metrics are innermost so they
+// measure the API rather than the middleware. Must be called with p.mu held for writing.
+func (p *pipeline) build() {
+	h := RequestMetrics(p.metrics)(p.send)
+	// The first middleware is the outermost, i.e sees the request first.
+	for i := len(p.middleware) - 1; 0 <= i; i-- {
+		h = p.middleware[i](h)
+	}
+	p.chain = h
+}
+
+// use appends middleware to the chain.
+func (p *pipeline) use(mw ...Middleware) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range mw {
+		if m != nil {
+			p.middleware = append(p.middleware, m)
+		}
+	}
+	p.build()
+}
+
+// setClient sets the http client used to send requests.
+func (p *pipeline) setClient(c *http.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.client = c
+}
+
+// setMetrics sets where the duration and status of requests are reported.
+func (p *pipeline) setMetrics(m Metrics) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.metrics = m
+	p.build()
+}
+
+// httpClient returns the http client used to send requests.
+func (p *pipeline) httpClient() *http.Client {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.client
+}
+
+// do sends req through the middleware chain.
+func (p *pipeline) do(req *Request) (*Response, error) {
+	p.mu.RLock()
+	chain := p.chain
+	p.mu.RUnlock()
+	return chain(req)
+}
+
+// send is the end of the chain, it performs the http request.
+func (p *pipeline) send(req *Request) (*Response, error) {
+	resp, err := p.httpClient().Do(req.HTTP)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// newRequest returns a Request for the endpoint, moved to the configured base URL, with
+// params encoded in the query.
+func (p *pipeline) newRequest(ctx context.Context, method, endpoint string, params Parameters, body []byte) (*Request, error) {
+	endpoint = p.urls.resolve(endpoint)
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = params.encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{Endpoint: endpoint, Params: params, HTTP: httpReq.WithContext(ctx)}, nil
+}
+
+// Use appends middleware to the chain every request to the API, including the
+// subscription endpoints, is sent through. Middleware is applied in the order given,
+// the first one sees the request first and the response last.
+func (a *client) Use(mw ...Middleware) {
+	a.handler.pipeline.use(mw...)
+}
+
+// SetHTTPClient sets the http client used to send requests, e.g. to use a custom
+// transport. nil restores the default client.
+func (a *client) SetHTTPClient(c *http.Client) {
+	if c == nil {
+		c = &http.Client{Timeout: default_http_timeout}
+	}
+	a.handler.pipeline.setClient(c)
+}
+
+// RequestLogger returns a Middleware logging the method, endpoint, parameters, status
+// and duration of every request to l. The body of the response is logged as well if
+// logBody returns true for the endpoint; logBody may be nil. Tokens are redacted from
+// the parameters.
+func RequestLogger(l Logger, logBody func(endpoint string) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request) (*Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			args := []interface{}{
+				"method", req.HTTP.Method,
+				"endpoint", req.Endpoint,
+				"params", redactParams(req.Params),
+				"duration", time.Since(start),
+			}
+
+			if err != nil {
+				l.Error("Request failed", append(args, "error", err)...)
+				return resp, err
+			}
+			args = append(args, "status", resp.StatusCode)
+			if logBody != nil && logBody(req.Endpoint) {
+				args = append(args, "body", string(resp.Body))
+			}
+			l.Info("Request done", args...)
+			return resp, err
+		}
+	}
+}
+
+// RequestMetrics returns a Middleware reporting the duration of every request to m as
+// abios_http_request_seconds, labelled with the method, endpoint family and status code.
+// Requests that got no response have status "error". The Metrics given to SetMetrics
+// already receive these, use RequestMetrics to report elsewhere or to include the time
+// spent in other middleware.
+func RequestMetrics(m Metrics) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request) (*Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+
+			status := "error"
+			if err == nil {
+				status = strconv.Itoa(resp.StatusCode)
+			}
+			m.Observe(metricHTTPRequest, time.Since(start).Seconds(), Labels{
+				"method":   req.HTTP.Method,
+				"endpoint": route.Family(req.Endpoint),
+				"status":   status,
+			})
+			return resp, err
+		}
+	}
+}
+
+// HeaderInjector returns a Middleware setting the given headers on every request, e.g.
+// to tag requests with a tenant ID.
+func HeaderInjector(header http.Header) Middleware {
+	return func(next Handler) Handler {
+		return func(req *Request) (*Response, error) {
+			for key, values := range header {
+				req.HTTP.Header.Del(key)
+				for _, v := range values {
+					req.HTTP.Header.Add(key, v)
+				}
+			}
+			return next(req)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// reply returns a Handler answering every request with status, or failing with err if
+// it isn't nil.
+func reply(status int, err error) Handler {
+	return func(req *Request) (*Response, error) {
+		if err != nil {
+			return nil, err
+		}
+		return &Response{StatusCode: status, Body: []byte(`{"id":1}`)}, nil
+	}
+}
+
+// testRequest returns a GET Request for endpoint with params.
+func testRequest(t *testing.T, endpoint string, params Parameters) *Request {
+	t.Helper()
+	httpReq, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Request{Endpoint: endpoint, Params: params, HTTP: httpReq}
+}
+
+// loggedLine is a message and its arguments as given to a Logger.
+type loggedLine struct {
+	level string
+	msg   string
+	args  []interface{}
+}
+
+// lineLogger is a Logger remembering everything logged at info level and above.
+type lineLogger struct {
+	nopLogger
+	lines []loggedLine
+}
+
+func (l *lineLogger) Info(msg string, args ...interface{}) {
+	l.lines = append(l.lines, loggedLine{"info", msg, args})
+}
+
+func (l *lineLogger) Warn(msg string, args ...interface{}) {
+	l.lines = append(l.lines, loggedLine{"warn", msg, args})
+}
+
+func (l *lineLogger) Error(msg string, args ...interface{}) {
+	l.lines = append(l.lines, loggedLine{"error", msg, args})
+}
+
+// arg returns the value logged for key.
+func (l loggedLine) arg(key string) interface{} {
+	for i := 0; i+1 < len(l.args); i += 2 {
+		if l.args[i] == key {
+			return l.args[i+1]
+		}
+	}
+	return nil
+}
+
+// observation is a value given to Metrics.Observe.
+type observation struct {
+	name   string
+	value  float64
+	labels Labels
+}
+
+// recordingMetrics is a Metrics remembering the observations.
+type recordingMetrics struct {
+	nopMetrics
+	mu           sync.Mutex
+	observations []observation
+}
+
+func (m *recordingMetrics) Observe(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations = append(m.observations, observation{name, value, labels})
+}
+
+func TestPipelineOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, s)
+	}
+	named := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(req *Request) (*Response, error) {
+				record(name + " request")
+				resp, err := next(req)
+				record(name + " response")
+				return resp, err
+			}
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("api")
+	}))
+	defer server.Close()
+
+	p := newPipeline()
+	p.use(named("first"), nil, named("second"))
+	p.use(named("third"))
+
+	req, err := p.newRequest(context.Background(), "GET", server.URL+"/v2/series", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"first request", "second request", "third request",
+		"api",
+		"third response", "second response", "first response",
+	}
+	if strings.Join(order, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+}
+
+func TestHeaderInjector(t *testing.T) {
+	req := testRequest(t, "https://api.abiosgaming.com/v2/series", nil)
+	req.HTTP.Header.Set("X-Tenant", "old")
+	req.HTTP.Header.Set("X-Other", "kept")
+
+	var got http.Header
+	next := func(req *Request) (*Response, error) {
+		got = req.HTTP.Header.Clone()
+		return &Response{StatusCode: 200}, nil
+	}
+	inject := HeaderInjector(http.Header{
+		"X-Tenant": {"acme"},
+		"X-Tags":   {"a", "b"},
+	})
+	if _, err := inject(next)(req); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"X-Tenant", []string{"acme"}},
+		{"X-Tags", []string{"a", "b"}},
+		{"X-Other", []string{"kept"}},
+	}
+	for _, tt := range tests {
+		if strings.Join(got.Values(tt.key), ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s = %v, want %v", tt.key, got.Values(tt.key), tt.want)
+		}
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	params := Parameters{
+		"access_token":  {"secret-token"},
+		"client_secret": {"secret-client"},
+		"page":          {"2"},
+	}
+
+	tests := []struct {
+		name      string
+		next      Handler
+		logBody   func(string) bool
+		wantLevel string
+		wantMsg   string
+		wantBody  bool
+	}{
+		{"done", reply(200, nil), nil, "info", "Request done", false},
+		{"done with body", reply(200, nil), func(string) bool { return true }, "info", "Request done", true},
+		{"body not wanted", reply(200, nil), func(string) bool { return false }, "info", "Request done", false},
+		{"failed", reply(0, errors.New("connection refused")), nil, "error", "Request failed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &lineLogger{}
+			req := testRequest(t, "https://api.abiosgaming.com/v2/series", params)
+			RequestLogger(l, tt.logBody)(tt.next)(req)
+
+			if len(l.lines) != 1 {
+				t.Fatalf("logged %d lines, want 1", len(l.lines))
+			}
+			line := l.lines[0]
+			if line.level != tt.wantLevel || line.msg != tt.wantMsg {
+				t.Errorf("logged %s %q, want %s %q", line.level, line.msg, tt.wantLevel, tt.wantMsg)
+			}
+			if logged := fmt.Sprint(line.args...); strings.Contains(logged, "secret-") {
+				t.Errorf("a secret is logged: %s", logged)
+			}
+			logged, _ := line.arg("params").(Parameters)
+			for _, key := range []string{"access_token", "client_secret"} {
+				if v := logged[key]; len(v) != 1 || v[0] != redacted {
+					t.Errorf("%s logged as %q, want %q", key, v, redacted)
+				}
+			}
+			if v := logged["page"]; len(v) != 1 || v[0] != "2" {
+				t.Errorf("page logged as %q, want 2", v)
+			}
+			if (line.arg("body") != nil) != tt.wantBody {
+				t.Errorf("logged body %v, want body logged %v", line.arg("body"), tt.wantBody)
+			}
+			if params["access_token"][0] != "secret-token" {
+				t.Error("the request's parameters are redacted")
+			}
+		})
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		next     Handler
+		want     Labels
+	}{
+		{"ok", "https://api.abiosgaming.com/v2/series/1234", reply(200, nil),
+			Labels{"method": "GET", "endpoint": "/v2/series/:id", "status": "200"}},
+		{"rate limited", "https://api.abiosgaming.com/v2/teams", reply(429, nil),
+			Labels{"method": "GET", "endpoint": "/v2/teams", "status": "429"}},
+		{"no response", "https://api.abiosgaming.com/v2/teams", reply(0, errors.New("timeout")),
+			Labels{"method": "GET", "endpoint": "/v2/teams", "status": "error"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &recordingMetrics{}
+			RequestMetrics(m)(tt.next)(testRequest(t, tt.endpoint, nil))
+
+			if len(m.observations) != 1 {
+				t.Fatalf("got %d observations, want 1", len(m.observations))
+			}
+			o := m.observations[0]
+			if o.name != metricHTTPRequest {
+				t.Errorf("observed %s, want %s", o.name, metricHTTPRequest)
+			}
+			if len(o.labels) != len(tt.want) {
+				t.Fatalf("got labels %v, want %v", o.labels, tt.want)
+			}
+			for k, v := range tt.want {
+				if o.labels[k] != v {
+					t.Errorf("label %s = %q, want %q", k, o.labels[k], v)
+				}
+			}
+		})
+	}
+}
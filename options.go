@@ -0,0 +1,205 @@
+package abios
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Option configures a client created by New.
+type Option func(*client)
+
+// WithBaseURL makes the client use the REST API at u, e.g. a stand-in server in tests,
+// instead of "https://api.abiosgaming.com/v2/".
+func WithBaseURL(u string) Option {
+	return func(c *client) {
+		c.handler.pipeline.urls.rest = withSlash(u)
+	}
+}
+
+// WithPushURLs makes the client connect to the push API socket at socket and manage
+// subscriptions through the push REST API at rest, instead of
+// "wss://ws.abiosgaming.com/v0" and "https://ws.abiosgaming.com/v0/".
+func WithPushURLs(socket, rest string) Option {
+	return func(c *client) {
+		c.handler.pipeline.urls.pushSocket = strings.TrimSuffix(socket, "/")
+		c.handler.pipeline.urls.pushREST = withSlash(rest)
+	}
+}
+
+// WithHTTPClient makes the client send requests, including the one authenticating in
+// New, with hc. See also SetHTTPClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *client) {
+		if hc != nil {
+			c.handler.pipeline.setClient(hc)
+		}
+	}
+}
+
+// WithSeriesFilters sets the local filters applied to messages on the 'series' channel,
+// see SetSeriesFilters.
+func WithSeriesFilters(filters ...SeriesFilter) Option {
+	return func(c *client) {
+		c.SetSeriesFilters(filters...)
+	}
+}
+
+// WithPushKeepAlive sets how the push connection is kept alive, see SetPushKeepAlive.
+func WithPushKeepAlive(pingInterval, pongTimeout time.Duration) Option {
+	return func(c *client) {
+		c.SetPushKeepAlive(pingInterval, pongTimeout)
+	}
+}
+
+// WithPushLatencySLO sets the push latency above which a warning is logged, see
+// SetPushLatencySLO.
+func WithPushLatencySLO(slo time.Duration) Option {
+	return func(c *client) {
+		c.SetPushLatencySLO(slo)
+	}
+}
+
+// WithQueueCapacity sets how many requests can wait in the queue, see SetQueueCapacity.
+func WithQueueCapacity(capacity int) Option {
+	return func(c *client) {
+		c.SetQueueCapacity(capacity)
+	}
+}
+
+// WithOverflowPolicy sets what happens to a new request when the queue is full, see
+// SetOverflowPolicy.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(c *client) {
+		c.SetOverflowPolicy(policy)
+	}
+}
+
+// WithRate sets the outgoing rate, see SetRate.
+func WithRate(second, minute int) Option {
+	return func(c *client) {
+		c.SetRate(second, minute)
+	}
+}
+
+// WithLimiter makes the client wait for l before sending each request, see SetLimiter.
+func WithLimiter(l Limiter) Option {
+	return func(c *client) {
+		c.SetLimiter(l)
+	}
+}
+
+// WithQuotas limits the number of requests sent within the windows of the given quotas,
+// see SetQuotas. If the usage can't be loaded from store the error is logged and
+// reported by Quotas and Health. The store is then left alone and background requests
+// are held back as if only the reserve were left, until SetQuotas succeeds.
+func WithQuotas(store QuotaStore, quotas ...Quota) Option {
+	return func(c *client) {
+		usage, err := loadUsage(store)
+		if err != nil {
+			c.logger().Error("Loading quota usage failed, holding back background requests", "error", err)
+		}
+		c.handler.quotas.apply(store, quotas, usage, err)
+	}
+}
+
+// WithQuotaWarning sets a function called whenever a quota crosses one of its
+// thresholds, see OnQuotaWarning.
+func WithQuotaWarning(fn func(QuotaStatus)) Option {
+	return func(c *client) {
+		c.OnQuotaWarning(fn)
+	}
+}
+
+// WithAdaptiveRate turns adapting the outgoing rate on or off, see SetAdaptiveRate.
+func WithAdaptiveRate(enabled bool) Option {
+	return func(c *client) {
+		c.SetAdaptiveRate(enabled)
+	}
+}
+
+// WithCircuitBreaker configures the circuit breaker, see SetCircuitBreaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *client) {
+		c.SetCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// WithCircuitStateChange sets a function called whenever the circuit breaker changes
+// state, see OnCircuitStateChange.
+func WithCircuitStateChange(fn func(from, to CircuitState)) Option {
+	return func(c *client) {
+		c.OnCircuitStateChange(fn)
+	}
+}
+
+// WithMiddleware appends middleware to the chain requests are sent through, see Use.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *client) {
+		c.Use(mw...)
+	}
+}
+
+// WithLogger sets where the SDK writes its log output, see SetLogger. Give it before
+// the other options to see what they log.
+func WithLogger(l Logger) Option {
+	return func(c *client) {
+		c.SetLogger(l)
+	}
+}
+
+// WithMetrics sets where the SDK reports its measurements, see SetMetrics.
+func WithMetrics(m Metrics) Option {
+	return func(c *client) {
+		c.SetMetrics(m)
+	}
+}
+
+// WithTracer sets the Tracer SDK calls are traced with, see SetTracer.
+func WithTracer(t Tracer) Option {
+	return func(c *client) {
+		c.SetTracer(t)
+	}
+}
+
+// WithStrictDecoding makes the client fail responses with fields the structs don't
+// model, see SetStrictDecoding.
+func WithStrictDecoding(strict bool) Option {
+	return func(c *client) {
+		c.SetStrictDecoding(strict)
+	}
+}
+
+// baseURLs are the locations of the APIs the client talks to. The endpoints are
+// declared relative to the default locations and moved by resolve.
+type baseURLs struct {
+	rest       string
+	pushSocket string
+	pushREST   string
+}
+
+// defaultBaseURLs returns the locations of the Abios APIs.
+func defaultBaseURLs() baseURLs {
+	return baseURLs{rest: baseUrl, pushSocket: wsBaseUrl, pushREST: wsRestUrl}
+}
+
+// resolve moves endpoint from its default location to the configured one.
+func (b baseURLs) resolve(endpoint string) string {
+	switch {
+	case strings.HasPrefix(endpoint, baseUrl):
+		return b.rest + strings.TrimPrefix(endpoint, baseUrl)
+	case strings.HasPrefix(endpoint, wsRestUrl):
+		return b.pushREST + strings.TrimPrefix(endpoint, wsRestUrl)
+	case strings.HasPrefix(endpoint, wsBaseUrl):
+		return b.pushSocket + strings.TrimPrefix(endpoint, wsBaseUrl)
+	}
+	return endpoint
+}
+
+// withSlash returns u with a trailing slash.
+func withSlash(u string) string {
+	if strings.HasSuffix(u, "/") {
+		return u
+	}
+	return u + "/"
+}
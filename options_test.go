@@ -0,0 +1,107 @@
+package abios
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingStore is a QuotaStore that can't load the usage and counts the saves.
+type failingStore struct {
+	mu    sync.Mutex
+	saves int
+}
+
+func (*failingStore) Load() (map[string]QuotaUsage, error) { return nil, errors.New("unreadable") }
+
+func (s *failingStore) Save(map[string]QuotaUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves++
+	return nil
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		opt   Option
+		check func(*client) bool
+	}{
+		{"series filters", WithSeriesFilters(TournamentTiers(1)), func(a *client) bool { return len(a.push.seriesFilters) == 1 }},
+		{"push keep-alive", WithPushKeepAlive(time.Minute, time.Second), func(a *client) bool {
+			return a.push.pingInterval == time.Minute && a.push.pongTimeout == time.Second
+		}},
+		{"push latency SLO", WithPushLatencySLO(time.Second), func(a *client) bool { return a.latency.slo == time.Second }},
+		{"queue capacity", WithQueueCapacity(7), func(a *client) bool { return a.handler.queueCapacity() == 7 }},
+		{"overflow policy", WithOverflowPolicy(OverflowShed), func(a *client) bool { return a.handler.overflow == OverflowShed }},
+		{"rate", WithRate(2, 100), func(a *client) bool {
+			second, minute := a.Rate()
+			return second == 2 && minute == 100
+		}},
+		{"quotas", WithQuotas(nil, Quota{Name: "daily", Limit: 10, Window: 24 * time.Hour}), func(a *client) bool {
+			q := a.Quotas()
+			return len(q) == 1 && q[0].Remaining == 10
+		}},
+		{"adaptive rate", WithAdaptiveRate(false), func(a *client) bool { return !a.handler.adaptive.enabled }},
+		{"circuit breaker", WithCircuitBreaker(2, time.Minute), func(a *client) bool {
+			return a.handler.breaker.threshold == 2 && a.handler.breaker.cooldown == time.Minute
+		}},
+		{"strict decoding", WithStrictDecoding(true), func(a *client) bool { return a.handler.strict != 0 }},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New("id", "secret", WithBaseURL(server.URL+"/v2/"), tt.opt)
+			if !tt.check(a) {
+				t.Fatal("the option wasn't applied")
+			}
+		})
+	}
+}
+
+func TestWithQuotasLoadFailure(t *testing.T) {
+	logger := &recordingLogger{}
+	store := &failingStore{}
+	a := New("id", "secret", WithBaseURL("http://127.0.0.1:0/v2/"), WithLogger(logger),
+		WithQuotas(store, Quota{Name: "daily", Limit: 10, Window: 24 * time.Hour}))
+
+	if q := a.Quotas(); len(q) != 1 || q[0].Err == nil {
+		t.Fatalf("got quotas %+v, want the load failure reported", q)
+	}
+	if h := a.Health(); h.QuotaError == "" {
+		t.Error("Health didn't report the load failure")
+	}
+	if blocked, refuse := a.handler.quotas.blocked(PriorityBackground, time.Now()); !blocked || refuse {
+		t.Errorf("background requests blocked %v, refused %v, want them deferred", blocked, refuse)
+	}
+	if blocked, _ := a.handler.quotas.blocked(PriorityInteractive, time.Now()); blocked {
+		t.Error("interactive requests were blocked")
+	}
+
+	a.handler.quotas.take(time.Now())
+	time.Sleep(10 * time.Millisecond) // Saves happen in their own goroutine.
+	store.mu.Lock()
+	saves := store.saves
+	store.mu.Unlock()
+	if saves != 0 {
+		t.Errorf("the usage was saved %d times over the store that failed to load", saves)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	for _, msg := range logger.errors {
+		if strings.Contains(msg, "quota usage") {
+			return
+		}
+	}
+	t.Fatalf("the load failure wasn't logged, got %q", logger.errors)
+}
@@ -0,0 +1,214 @@
+package abios
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default histogram buckets in seconds, the same as those of the Prometheus client.
+var default_prometheus_buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a Metrics keeping the measurements in memory and writing them in
+// the Prometheus text exposition format. It is an http.Handler, so it can be served
+// directly on the path Prometheus scrapes:
+//
+//	m := abios.NewPrometheusMetrics()
+//	a := abios.New(id, secret, abios.WithMetrics(m))
+//	http.Handle("/metrics", m)
+type PrometheusMetrics struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families map[string]*promFamily
+}
+
+// promFamily is all series of a metric.
+type promFamily struct {
+	kind   string // "counter", "gauge" or "histogram".
+	series map[string]*promSeries
+}
+
+// promSeries is a metric with a given set of labels.
+type promSeries struct {
+	labels Labels
+	value  float64  // Counters and gauges.
+	counts []uint64 // Histograms, per bucket, not cumulative.
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics returns a PrometheusMetrics whose histograms use the given bucket
+// upper bounds, or default buckets suitable for durations in seconds if none are given.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = default_prometheus_buckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	return &PrometheusMetrics{
+		buckets:  b,
+		families: make(map[string]*promFamily),
+	}
+}
+
+// Observe records value in the histogram called name.
+func (m *PrometheusMetrics) Observe(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.series(name, "histogram", labels)
+	if s == nil {
+		return
+	}
+	if s.counts == nil {
+		s.counts = make([]uint64, len(m.buckets))
+	}
+	if i := sort.SearchFloat64s(m.buckets, value); i < len(m.buckets) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.count++
+}
+
+// Add adds delta to the counter called name.
+func (m *PrometheusMetrics) Add(name string, delta float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s := m.series(name, "counter", labels); s != nil {
+		s.value += delta
+	}
+}
+
+// Set sets the gauge called name to value.
+func (m *PrometheusMetrics) Set(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s := m.series(name, "gauge", labels); s != nil {
+		s.value = value
+	}
+}
+
+// series returns the series of name with the given labels, creating it if needed. It
+// returns nil if name is already used by a metric of another kind. Must be called with
+// m.mu held.
+func (m *PrometheusMetrics) series(name, kind string, labels Labels) *promSeries {
+	f, ok := m.families[name]
+	if !ok {
+		f = &promFamily{kind: kind, series: make(map[string]*promSeries)}
+		m.families[name] = f
+	} else if f.kind != kind {
+		return nil
+	}
+
+	key := formatLabels(labels, "", "")
+	s, ok := f.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &promSeries{labels: copied}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteTo writes all metrics to w in the Prometheus text exposition format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	m.mu.Lock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := m.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", name, key, formatValue(s.value))
+				continue
+			}
+
+			var cumulative uint64
+			for i, upper := range m.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", formatValue(upper)), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, key, formatValue(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, key, s.count)
+		}
+	}
+	m.mu.Unlock()
+
+	return b.WriteTo(w)
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// formatLabels returns labels in exposition format, e.g. `{lane="live"}`, sorted by
+// name, with the label extraName added if it isn't empty.
+func formatLabels(labels Labels, extraName, extraValue string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(labels[name])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds.
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatValue formats a sample value as expected by Prometheus.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
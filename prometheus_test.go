@@ -0,0 +1,92 @@
+package abios
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusWriteTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(m *PrometheusMetrics)
+		want   string
+	}{
+		{"counter", func(m *PrometheusMetrics) {
+			m.Add("requests_total", 1, Labels{"lane": "live"})
+			m.Add("requests_total", 2, Labels{"lane": "live"})
+			m.Add("requests_total", 1, Labels{"lane": "background"})
+		}, `# TYPE requests_total counter
+requests_total{lane="background"} 1
+requests_total{lane="live"} 3
+`},
+		{"gauge", func(m *PrometheusMetrics) {
+			m.Set("queue_depth", 4, nil)
+			m.Set("queue_depth", 2.5, nil)
+		}, `# TYPE queue_depth gauge
+queue_depth 2.5
+`},
+		{"histogram", func(m *PrometheusMetrics) {
+			m.Observe("wait_seconds", 0.5, Labels{"lane": "live"})
+			m.Observe("wait_seconds", 1, Labels{"lane": "live"})
+			m.Observe("wait_seconds", 3, Labels{"lane": "live"})
+			m.Observe("wait_seconds", 10, Labels{"lane": "live"})
+		}, `# TYPE wait_seconds histogram
+wait_seconds_bucket{lane="live",le="1"} 2
+wait_seconds_bucket{lane="live",le="5"} 3
+wait_seconds_bucket{lane="live",le="+Inf"} 4
+wait_seconds_sum{lane="live"} 14.5
+wait_seconds_count{lane="live"} 4
+`},
+		{"label values escaped", func(m *PrometheusMetrics) {
+			m.Add("errors_total", 1, Labels{"reason": "say \"no\"\nback\\slash", "code": "500"})
+		}, `# TYPE errors_total counter
+errors_total{code="500",reason="say \"no\"\nback\\slash"} 1
+`},
+		{"name used as another kind", func(m *PrometheusMetrics) {
+			m.Add("mixed", 1, nil)
+			m.Set("mixed", 7, nil)
+			m.Observe("mixed", 2, nil)
+		}, `# TYPE mixed counter
+mixed 1
+`},
+		{"families sorted by name", func(m *PrometheusMetrics) {
+			m.Set("b", 1, nil)
+			m.Add("a", 1, nil)
+		}, `# TYPE a counter
+a 1
+# TYPE b gauge
+b 1
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPrometheusMetrics(5, 1)
+			tt.record(m)
+
+			var b strings.Builder
+			if _, err := m.WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusServeHTTP(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.Add("requests_total", 1, nil)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got content type %q", ct)
+	}
+	if body := w.Body.String(); body != "# TYPE requests_total counter\nrequests_total 1\n" {
+		t.Errorf("got body %q", body)
+	}
+}
@@ -3,8 +3,9 @@ package abios
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"net"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gobuffalo/uuid"
@@ -28,10 +29,107 @@ const (
 	CloseInternalError         = 4500 // Unspecified error due to problem in server
 )
 
-/*
-func (a *client) UpdateSubscription(id int, sub Subscription) (Subscription, error) {
+// Default values for the liveness checks of the push connection.
+const (
+	default_ping_interval = 30 * time.Second
+	default_pong_timeout  = 10 * time.Second
+)
+
+// pushState holds the websocket connection to the push API and what we know about
+// its liveness.
+type pushState struct {
+	mu             sync.Mutex
+	conn           *websocket.Conn
+	reconnectToken uuid.UUID
+	pingInterval   time.Duration // How often we ping the server.
+	pongTimeout    time.Duration // How long we wait for a pong before giving up.
+	lastMessageAt  time.Time
+	lastPongAt     time.Time
+	subscriptionID uuid.UUID     // Of the last connection made.
+	connected      bool          // Whether the connection is up, false while reconnecting.
+	stop           chan struct{} // Closed by PushServiceClose to stop the loops reading and pinging.
+	seriesFilters  []SeriesFilter
+}
+
+// newPushState returns a pushState with default liveness settings.
+func newPushState() *pushState {
+	return &pushState{
+		reconnectToken: uuid.Nil,
+		pingInterval:   default_ping_interval,
+		pongTimeout:    default_pong_timeout,
+	}
+}
+
+// setDisconnected records that the connection is down.
+func (p *pushState) setDisconnected() {
+	p.mu.Lock()
+	p.connected = false
+	p.mu.Unlock()
+}
 
+// closeConnection closes the current websocket connection, if any.
+func (p *pushState) closeConnection() error {
+	p.mu.Lock()
+	conn := p.conn
+	p.conn = nil
+	p.connected = false
+	p.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return conn.Close()
+}
+
+// connection returns the current websocket connection, which may be nil.
+func (p *pushState) connection() *websocket.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn
+}
+
+// deadline returns the point in time we must have heard from the server by.
+func (p *pushState) deadline() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Now().Add(p.pingInterval + p.pongTimeout)
 }
+
+// SetPushKeepAlive sets how often the push connection is pinged and how long we wait
+// for a pong before the connection is considered dead and re-established. A value less
+// than or equal to 0 means the previous value is kept. Default values are (30s, 10s).
+func (a *client) SetPushKeepAlive(pingInterval, pongTimeout time.Duration) {
+	a.push.mu.Lock()
+	defer a.push.mu.Unlock()
+
+	if 0 < pingInterval {
+		a.push.pingInterval = pingInterval
+	}
+
+	if 0 < pongTimeout {
+		a.push.pongTimeout = pongTimeout
+	}
+}
+
+// LastMessageAt returns when a message was last read from the push connection. The
+// zero time means no message has been read yet.
+func (a *client) LastMessageAt() time.Time {
+	a.push.mu.Lock()
+	defer a.push.mu.Unlock()
+	return a.push.lastMessageAt
+}
+
+// LastPongAt returns when the push server last answered a ping. The zero time means
+// no pong has been received yet.
+func (a *client) LastPongAt() time.Time {
+	a.push.mu.Lock()
+	defer a.push.mu.Unlock()
+	return a.push.lastPongAt
+}
+
+/*
 func (a *client) PushServiceConfig() ([]byte, error) {
 
 }
@@ -39,63 +137,145 @@ func (a *client) PushServiceConfig() ([]byte, error) {
 
 func (a *client) PushServiceConnect(subscriptionID uuid.UUID) error {
 	params := make(Parameters)
-	params.Set("access_token", a.oauth.AccessToken)
+	params.Set("access_token", a.oauth.get().AccessToken)
 	params.Set("subscription_id", subscriptionID.String())
 
-	if a.reconnectToken != uuid.Nil {
-		params.Set("reconnect_token", a.reconnectToken.String())
+	a.push.mu.Lock()
+	reconnectToken := a.push.reconnectToken
+	a.push.mu.Unlock()
+
+	if reconnectToken != uuid.Nil {
+		params.Set("reconnect_token", reconnectToken.String())
 	}
 
-	u, err := url.Parse(wsBaseUrl)
+	u, err := url.Parse(a.handler.pipeline.urls.resolve(wsBaseUrl))
 	if err != nil {
 		return err
 	}
 	u.RawQuery = params.encode()
 
-	log.Printf("[INFO] Dialing to socket '%v'\n", u.String())
+	a.logger().Info("Dialing push API", "endpoint", redactURL(u), "subscription_id", subscriptionID)
 
 	var dialer *websocket.Dialer
 	conn, res, err := dialer.Dial(u.String(), nil)
 
 	if err == websocket.ErrBadHandshake {
-		log.Printf("[ERROR]: Failed to connect to WS url. Handshake status='%d'\n", res.StatusCode)
+		a.logger().Error("Push API handshake failed", "endpoint", redactURL(u), "subscription_id", subscriptionID,
+			"status", res.StatusCode)
 		return err
 	} else if err != nil {
-		log.Printf("[ERROR]: Failed to connect to WS url. Error='%s'\n", err.Error())
+		a.logger().Error("Failed to connect to push API", "endpoint", redactURL(u), "subscription_id", subscriptionID,
+			"error", err)
 		return err
 	}
 
-	a.wsConn = conn
+	// Every pong and every message pushes the read deadline forward. If neither arrives
+	// in time the next read fails and the read loop reconnects.
+	conn.SetReadDeadline(a.push.deadline())
+	conn.SetPongHandler(func(string) error {
+		a.push.mu.Lock()
+		a.push.lastPongAt = time.Now()
+		a.push.mu.Unlock()
+		return conn.SetReadDeadline(a.push.deadline())
+	})
+
+	a.push.mu.Lock()
+	old := a.push.conn
+	a.push.conn = conn
+	a.push.subscriptionID = subscriptionID
+	a.push.connected = true
+	a.push.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
 
 	return nil
 }
 
+// PushServiceInit connects to the push API and starts delivering the messages of the
+// given subscription on the returned series channel. Errors are sent on the returned
+// error channel. The series channel is closed once no more messages will be delivered,
+// i.e. after a connection or reconnection failure has been reported or once
+// PushServiceClose is called.
 func (a *client) PushServiceInit(subscriptionID uuid.UUID) (chan SeriesMessage, chan error) {
 	errors := make(chan error, 1)
 	series := make(chan SeriesMessage, 1)
+	stop := make(chan struct{})
+	done := make(chan struct{})
 
-	if err := a.PushServiceConnect(subscriptionID); err != nil {
+	if err := a.handshake(subscriptionID); err != nil {
 		errors <- err
+		close(series)
 		return series, errors
 	}
+	a.push.mu.Lock()
+	a.push.stop = stop
+	a.push.mu.Unlock()
+
+	go a.keepAliveLoop(errors, stop, done)
+	go a.messageReadLoop(subscriptionID, series, errors, stop, done)
+
+	return series, errors
+}
+
+// handshake dials the push API for the given subscription and reads the init message,
+// keeping the reconnect token it carries for the next connection.
+func (a *client) handshake(subscriptionID uuid.UUID) error {
+	if err := a.PushServiceConnect(subscriptionID); err != nil {
+		return err
+	}
 
 	initMsg, err := a.handleInitMessage(subscriptionID)
 	if err != nil {
-		errors <- err
-		return series, errors
+		return err
 	}
-	a.reconnectToken = initMsg.ReconnectToken
+	a.push.mu.Lock()
+	a.push.reconnectToken = initMsg.ReconnectToken
+	a.push.mu.Unlock()
+	return nil
+}
 
-	go a.keepAliveLoop(errors)
-	go a.messageReadLoop(subscriptionID, series, errors)
+// PushServiceClose closes the push connection, which frees its subscriber slot on the
+// server, and stops the goroutines started by PushServiceInit. Nothing is sent on the
+// channels PushServiceInit returned afterwards, and its series channel is closed.
+func (a *client) PushServiceClose() error {
+	a.push.mu.Lock()
+	stop := a.push.stop
+	a.push.stop = nil
+	a.push.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	return a.push.closeConnection()
+}
 
-	return series, errors
+// stopped reports whether stop is closed.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// report sends err on errors unless stop is closed first, in which case it returns
+// false.
+func report(errors chan<- error, err error, stop <-chan struct{}) bool {
+	select {
+	case errors <- err:
+		return true
+	case <-stop:
+		return false
+	}
 }
 
 func (a *client) handleInitMessage(subscriptionID uuid.UUID) (InitResponseMessage, error) {
 	var m InitResponseMessage
 
-	_, message, err := a.wsConn.ReadMessage()
+	_, message, err := a.push.connection().ReadMessage()
 	if closeErr, ok := err.(*websocket.CloseError); ok {
 		var errMsg string
 		switch closeErr.Code {
@@ -113,11 +293,12 @@ func (a *client) handleInitMessage(subscriptionID uuid.UUID) (InitResponseMessag
 			errMsg = fmt.Sprintf("Server sent unrecognized error code %d", closeErr.Code)
 		}
 
-		log.Printf("[ERROR]: Server closed connection: %s\n", errMsg)
+		a.logger().Error("Push API closed connection", "subscription_id", subscriptionID,
+			"close_code", closeErr.Code, "reason", errMsg)
 		return m, err
 	} else if err != nil {
 		// Websocket read encountered some other error, we won't try to recover
-		log.Printf("[ERROR]: Failed to read `init' message. Error='%s'\n", err.Error())
+		a.logger().Error("Failed to read init message", "subscription_id", subscriptionID, "error", err)
 		return m, err
 	}
 
@@ -125,66 +306,145 @@ func (a *client) handleInitMessage(subscriptionID uuid.UUID) (InitResponseMessag
 	return m, nil
 }
 
-func (a *client) messageReadLoop(subscriptionID uuid.UUID, series chan<- SeriesMessage, errors chan<- error) {
+// messageReadLoop reads messages from the push connection and delivers those on the
+// series channel, reconnecting when the connection is lost. The loop returns after
+// reporting an error it can't recover from, closing the connection, or once stop is
+// closed. It then closes the series channel, and done to stop the keep-alive loop.
+func (a *client) messageReadLoop(subscriptionID uuid.UUID, series chan<- SeriesMessage, errors chan<- error, stop <-chan struct{}, done chan<- struct{}) {
+	defer func() {
+		close(done)
+		close(series)
+	}()
+
 	for {
-		_, message, err := a.wsConn.ReadMessage()
+		conn := a.push.connection()
+		if stopped(stop) || conn == nil {
+			a.push.closeConnection() // One a reconnect dialed while PushServiceClose ran.
+			return
+		}
+
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if stopped(stop) {
+				return // PushServiceClose closed the connection.
+			}
+			a.push.setDisconnected()
+		}
 
 		if closeErr, ok := err.(*websocket.CloseError); ok {
-			log.Printf("[INFO]: Websocket was closed, starting reconnect loop. Reason='%s'\n", closeErr.Error())
+			a.logger().Info("Push connection closed, reconnecting", "subscription_id", subscriptionID,
+				"close_code", closeErr.Code, "reason", closeErr.Text)
+			a.handler.getMetrics().Add(metricPushReconnects, 1, Labels{"reason": "closed"})
 
-			authErr := a.authenticate()
-			if authErr != nil {
-				errors <- fmt.Errorf("%v", authErr)
+			if err := a.reconnect(subscriptionID); err != nil {
+				a.push.closeConnection()
+				report(errors, err, stop)
 				return
 			}
 
-			err = a.PushServiceConnect(subscriptionID)
-			if err != nil {
-				errors <- err
+			continue
+		} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			a.logger().Info("No message or pong received within deadline, reconnecting",
+				"subscription_id", subscriptionID)
+			a.handler.getMetrics().Add(metricPushReconnects, 1, Labels{"reason": "timeout"})
+
+			if err := a.reconnect(subscriptionID); err != nil {
+				a.push.closeConnection()
+				report(errors, err, stop)
 				return
 			}
 
 			continue
 		} else if err != nil {
-			log.Printf("[ERROR]: Failed to read message. Error='%s'\n", err.Error())
-			errors <- err
+			a.logger().Error("Failed to read push message", "subscription_id", subscriptionID, "error", err)
+			a.push.closeConnection()
+			report(errors, err, stop)
 			return
 		}
 
+		receivedAt := time.Now()
+		a.push.mu.Lock()
+		a.push.lastMessageAt = receivedAt
+		a.push.mu.Unlock()
+		conn.SetReadDeadline(a.push.deadline())
+
 		// sanity check
 		var m PushMessage
 		err = json.Unmarshal(message, &m)
 		if err != nil {
-			log.Printf("[ERROR]: Failed to unmarshal to message struct. Error='%s', Message='%s'\n", err.Error(), message)
-			errors <- err
+			a.logger().Error("Failed to unmarshal push message", "subscription_id", subscriptionID,
+				"error", err, "message", string(message))
+			if !report(errors, err, stop) {
+				return
+			}
 			continue
 		}
+		a.handler.getMetrics().Add(metricPushMessages, 1, Labels{"channel": m.Channel})
 
 		switch m.Channel {
 		case "series":
 			var s SeriesMessage
 			err = json.Unmarshal(message, &s)
 			if err != nil {
-				log.Printf("[ERROR]: Failed to unmarshal to message struct. Error='%s', Message='%s'\n", err.Error(), message)
-				errors <- err
+				a.logger().Error("Failed to unmarshal push message", "subscription_id", subscriptionID,
+					"channel", m.Channel, "error", err, "message", string(message))
+				if !report(errors, err, stop) {
+					return
+				}
+				continue
+			}
+			a.recordLatency(m.Channel, s.Payload.Events, m.CreatedTimestamp, receivedAt)
+
+			if !a.acceptSeries(s) {
 				continue
 			}
 
 			s.Raw = message
-			series <- s
+			select {
+			case series <- s:
+			case <-stop:
+				return
+			}
+		default:
+			a.recordLatency(m.Channel, nil, m.CreatedTimestamp, receivedAt)
 		}
 
 	}
 }
 
-func (a *client) keepAliveLoop(errors chan<- error) {
+// reconnect re-authenticates and connects to the push API again for the given
+// subscription, going through the same handshake as PushServiceInit.
+func (a *client) reconnect(subscriptionID uuid.UUID) error {
+	authErr := a.authenticate()
+	if authErr != nil {
+		return fmt.Errorf("%v", authErr)
+	}
+
+	return a.handshake(subscriptionID)
+}
+
+// keepAliveLoop pings the push server until stop or done is closed, done being closed
+// by the read loop when it gives up on the connection.
+func (a *client) keepAliveLoop(errors chan<- error, stop, done <-chan struct{}) {
 	for {
-		time.Sleep(time.Second * 30)
-		if a.wsConn != nil {
-			err := a.wsConn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(3*time.Second))
-			if err != nil {
-				log.Printf("[ERROR]: Failed to send Ping message. Error='%s'\n", err.Error())
-				errors <- err
+		a.push.mu.Lock()
+		interval := a.push.pingInterval
+		a.push.mu.Unlock()
+
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		case <-done:
+			return
+		}
+		if conn := a.push.connection(); conn != nil {
+			err := conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(3*time.Second))
+			if err != nil && !stopped(stop) && !stopped(done) {
+				a.logger().Error("Failed to send ping", "error", err)
+				if !report(errors, err, done) {
+					return
+				}
 				continue
 			}
 		}
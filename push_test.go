@@ -0,0 +1,237 @@
+package abios_test
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	"github.com/PatronGG/abios-go-sdk/abiostest"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// reconnectCounter is a Metrics counting push reconnects by reason.
+type reconnectCounter struct {
+	mu      sync.Mutex
+	reasons map[string]int
+}
+
+func (r *reconnectCounter) Observe(name string, value float64, labels abios.Labels) {}
+func (r *reconnectCounter) Set(name string, value float64, labels abios.Labels)     {}
+
+func (r *reconnectCounter) Add(name string, delta float64, labels abios.Labels) {
+	if name != "abios_push_reconnects_total" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reasons[labels["reason"]] += int(delta)
+}
+
+func (r *reconnectCounter) count(reason string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reasons[reason]
+}
+
+// eventually fails the test unless cond becomes true within five seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// subscriber is what the tests need of the client returned by New.
+type subscriber interface {
+	abios.PushSource
+	CreateSubscription(sub Subscription) (uuid.UUID, error)
+}
+
+// subscribe connects a to the push socket with a new subscription to the series channel.
+func subscribe(t *testing.T, a subscriber) (chan SeriesMessage, chan error) {
+	t.Helper()
+	id, err := a.CreateSubscription(Subscription{Name: "push", Filters: []SubscriptionFilter{{Channel: "series"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, errs := a.PushServiceInit(id)
+	t.Cleanup(func() { a.PushServiceClose() })
+	return series, errs
+}
+
+// receive waits for the next series message and checks its series id.
+func receive(t *testing.T, series <-chan SeriesMessage, errs <-chan error, id int64) {
+	t.Helper()
+	select {
+	case m := <-series:
+		if m.Payload.State.Id != id {
+			t.Fatalf("got series %d, want %d", m.Payload.State.Id, id)
+		}
+	case err := <-errs:
+		t.Fatalf("got error %v, want series %d", err, id)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("series %d isn't delivered", id)
+	}
+}
+
+// pushUntilReceived pushes series id until a client delivers it on series. Pushes can be
+// lost while the client reconnects, because the server only sends them to the sockets
+// connected at the time.
+func pushUntilReceived(t *testing.T, server *abiostest.Server, series <-chan SeriesMessage, errs <-chan error, id int64) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		server.Push(abiostest.NewSeriesMessage("update", SeriesStruct{Id: id}))
+		select {
+		case m := <-series:
+			if m.Payload.State.Id != id {
+				t.Fatalf("got series %d, want %d", m.Payload.State.Id, id)
+			}
+			return
+		case err := <-errs:
+			t.Fatalf("got error %v, want series %d", err, id)
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("series %d isn't delivered", id)
+		}
+	}
+}
+
+func TestPushPongTimeout(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	counter := &reconnectCounter{reasons: make(map[string]int)}
+	opts := append(server.Options(), abios.WithPushKeepAlive(20*time.Millisecond, 100*time.Millisecond), abios.WithMetrics(counter))
+	a := abios.New("id", "secret", opts...)
+	series, errs := subscribe(t, a)
+
+	eventually(t, "a pong is received", func() bool { return !a.LastPongAt().IsZero() })
+	first := a.LastPongAt()
+	eventually(t, "LastPongAt advances", func() bool { return a.LastPongAt().After(first) })
+
+	server.AnswerPings(false)
+	eventually(t, "the missing pong makes the client reconnect", func() bool { return 0 < counter.count("timeout") })
+	server.AnswerPings(true)
+
+	// The new connection delivers messages and is kept alive.
+	pushUntilReceived(t, server, series, errs, 1)
+	reconnected := a.LastPongAt()
+	eventually(t, "LastPongAt advances after reconnecting", func() bool { return a.LastPongAt().After(reconnected) })
+	if n := counter.count("closed"); n != 0 {
+		t.Errorf("%d reconnects for closed connections, want 0", n)
+	}
+}
+
+func TestPushLastMessageAt(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+	series, errs := subscribe(t, a)
+
+	if !a.LastMessageAt().IsZero() {
+		t.Fatalf("LastMessageAt = %v before any message", a.LastMessageAt())
+	}
+	for i := int64(1); i <= 2; i++ {
+		before := a.LastMessageAt()
+		server.Push(abiostest.NewSeriesMessage("update", SeriesStruct{Id: i}))
+		receive(t, series, errs, i)
+		if !a.LastMessageAt().After(before) {
+			t.Fatalf("LastMessageAt = %v after message %d, was %v", a.LastMessageAt(), i, before)
+		}
+	}
+}
+
+func TestPushClosedByServer(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+	}{
+		{"internal error", abios.CloseInternalError},
+		{"going away", websocket.CloseGoingAway},
+		{"normal closure", websocket.CloseNormalClosure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := abiostest.NewServer()
+			defer server.Close()
+			counter := &reconnectCounter{reasons: make(map[string]int)}
+			a := abios.New("id", "secret", append(server.Options(), abios.WithMetrics(counter))...)
+			series, errs := subscribe(t, a)
+
+			server.Disconnect(tt.code, "")
+			eventually(t, "the client reconnects", func() bool { return counter.count("closed") == 1 })
+			pushUntilReceived(t, server, series, errs, 1)
+		})
+	}
+}
+
+func TestPushInitRefused(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+
+	series, errs := a.PushServiceInit(uuid.Must(uuid.NewV4()))
+	select {
+	case err := <-errs:
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != abios.CloseUnknownSubscriptionID {
+			t.Fatalf("got %v, want close code %d", err, abios.CloseUnknownSubscriptionID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the refused connection isn't reported")
+	}
+	if _, ok := <-series; ok {
+		t.Fatal("got a message from a refused connection")
+	}
+}
+
+// keepAliveLoops returns the number of goroutines pinging a push connection.
+func keepAliveLoops() int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	return strings.Count(string(buf), "abios.(*client).keepAliveLoop(")
+}
+
+func TestPushReconnectRefused(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", append(server.Options(), abios.WithPushKeepAlive(20*time.Millisecond, time.Second))...)
+	before := keepAliveLoops()
+	series, errs := subscribe(t, a)
+
+	// The client can't authenticate again, so it can't reconnect after the disconnect.
+	server.SetCredentials("other", "credentials")
+	server.Disconnect(abios.CloseInternalError, "maintenance")
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("got a nil error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failed reconnect isn't reported")
+	}
+	select {
+	case _, ok := <-series:
+		if ok {
+			t.Fatal("got a message after the reconnect failed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the series channel is still open after the reconnect failed")
+	}
+	eventually(t, "the keep-alive loop exits", func() bool { return keepAliveLoops() == before })
+	if a.Health().Push.Connected {
+		t.Error("the client reports a connection after giving up on it")
+	}
+}
@@ -0,0 +1,337 @@
+package abios
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// QuotaPolicy decides what happens to background requests once a quota is down to its
+// reserve.
+type QuotaPolicy int
+
+const (
+	QuotaDefer  QuotaPolicy = iota // Keep them queued, in a queue of the same capacity, until the quota resets.
+	QuotaRefuse                    // Fail them with ErrQuotaExceeded.
+)
+
+// Quota limits the number of requests sent within a fixed window, e.g. a day. Windows
+// are aligned to the Unix epoch, so a 24 hour window resets at midnight UTC.
+type Quota struct {
+	Name       string        // Identifies the quota in the store and in warnings, e.g. "daily".
+	Limit      int           // Number of requests allowed per window.
+	Window     time.Duration // Length of the window.
+	Reserve    float64       // Fraction of the limit only interactive and live requests may use.
+	Policy     QuotaPolicy   // What to do with background requests once only the reserve is left.
+	Thresholds []float64     // Fractions of the limit at which a warning is given, e.g. 0.8 and 0.95.
+}
+
+// QuotaStatus describes the usage of a quota in the current window.
+type QuotaStatus struct {
+	Name      string
+	Limit     int
+	Used      int
+	Remaining int
+	ResetsAt  time.Time
+	Err       error // Why the usage couldn't be restored; Used then only counts requests since.
+}
+
+// QuotaUsage is what a QuotaStore persists for each quota.
+type QuotaUsage struct {
+	WindowStart time.Time `json:"window_start"`
+	Used        int       `json:"used"`
+}
+
+// QuotaStore persists quota usage so it survives restarts.
+type QuotaStore interface {
+	Load() (map[string]QuotaUsage, error)
+	Save(usage map[string]QuotaUsage) error
+}
+
+// FileQuotaStore is a QuotaStore keeping the usage as JSON in a local file.
+type FileQuotaStore struct {
+	path string
+}
+
+// NewFileQuotaStore returns a FileQuotaStore using the file at path.
+func NewFileQuotaStore(path string) *FileQuotaStore {
+	return &FileQuotaStore{path: path}
+}
+
+// Load reads the usage from the file. A missing file means nothing has been used. A file
+// that can't be read or decoded is an error, so the usage isn't silently reset.
+func (s *FileQuotaStore) Load() (map[string]QuotaUsage, error) {
+	usage := make(map[string]QuotaUsage)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, fmt.Errorf("decoding quota usage from %s: %w", s.path, err)
+	}
+	return usage, nil
+}
+
+// Save writes the usage to a temporary file next to the file and renames it, so the
+// file is never left half written.
+func (s *FileQuotaStore) Save(usage map[string]QuotaUsage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// quotaState is a Quota and its usage in the current window.
+type quotaState struct {
+	Quota
+	usage  QuotaUsage
+	warned int // Number of thresholds warned about in the current window.
+}
+
+// windowStart returns the start of the window now is in. Unlike time.Truncate, which
+// aligns to the zero time, windows are counted from the Unix epoch.
+func (q *quotaState) windowStart(now time.Time) time.Time {
+	n := now.UnixNano()
+	return time.Unix(0, n-n%int64(q.Window))
+}
+
+// roll starts a new window if the current one has ended.
+func (q *quotaState) roll(now time.Time) {
+	if start := q.windowStart(now); !start.Equal(q.usage.WindowStart) {
+		q.usage = QuotaUsage{WindowStart: start}
+		q.warned = 0
+	}
+}
+
+// status returns the usage of the quota.
+func (q *quotaState) status() QuotaStatus {
+	remaining := q.Limit - q.usage.Used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return QuotaStatus{
+		Name:      q.Name,
+		Limit:     q.Limit,
+		Used:      q.usage.Used,
+		Remaining: remaining,
+		ResetsAt:  q.usage.WindowStart.Add(q.Window),
+	}
+}
+
+// reserved reports whether only the reserve of the quota is left.
+func (q *quotaState) reserved() bool {
+	return float64(q.usage.Used) >= float64(q.Limit)*(1-q.Reserve)
+}
+
+// quotaTracker counts requests against the configured quotas.
+type quotaTracker struct {
+	mu        sync.Mutex
+	quotas    []*quotaState
+	store     QuotaStore
+	onWarning func(QuotaStatus)
+	loadErr   error                 // Why the usage couldn't be loaded from the store, if it couldn't.
+	logger    Logger                // Where failures to save the usage are logged.
+	unsaved   map[string]QuotaUsage // The latest usage, if it hasn't been given to the store yet.
+	saving    bool                  // Whether a goroutine is saving the usage.
+}
+
+// set replaces the quotas, restoring their usage from store if it isn't nil.
+func (t *quotaTracker) set(store QuotaStore, quotas []Quota) error {
+	usage, err := loadUsage(store)
+	if err != nil {
+		return err
+	}
+	t.apply(store, quotas, usage, nil)
+	return nil
+}
+
+// loadUsage returns the usage in store, or no usage if store is nil or fails to load.
+func loadUsage(store QuotaStore) (map[string]QuotaUsage, error) {
+	if store == nil {
+		return make(map[string]QuotaUsage), nil
+	}
+	usage, err := store.Load()
+	if err != nil || usage == nil {
+		return make(map[string]QuotaUsage), err
+	}
+	return usage, nil
+}
+
+// apply replaces the quotas, starting from the given usage. If loadErr isn't nil the
+// usage in store is unknown: it is then never saved over, and background requests are
+// held back as if only the reserve of every quota were left.
+func (t *quotaTracker) apply(store QuotaStore, quotas []Quota, usage map[string]QuotaUsage, loadErr error) {
+	now := time.Now()
+	states := make([]*quotaState, 0, len(quotas))
+	for _, q := range quotas {
+		if q.Limit <= 0 || q.Window <= 0 {
+			continue
+		}
+		s := &quotaState{Quota: q, usage: usage[q.Name]}
+		s.roll(now)
+		for s.warned < len(s.Thresholds) && float64(s.usage.Used) >= s.Thresholds[s.warned]*float64(s.Limit) {
+			s.warned++ // Don't repeat warnings given before a restart.
+		}
+		states = append(states, s)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.quotas = states
+	t.store = store
+	t.loadErr = loadErr
+}
+
+// blocked reports whether a request with priority p can't be sent now, and whether it
+// should be refused rather than deferred.
+func (t *quotaTracker) blocked(p Priority, now time.Time) (blocked, refuse bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, q := range t.quotas {
+		q.roll(now)
+		if q.usage.Used >= q.Limit {
+			if p == PriorityBackground && q.Policy == QuotaDefer {
+				blocked = true
+				continue
+			}
+			return true, true
+		}
+		if p == PriorityBackground && (q.reserved() || t.loadErr != nil) {
+			if q.Policy == QuotaRefuse {
+				return true, true
+			}
+			blocked = true
+		}
+	}
+	return blocked, false
+}
+
+// take counts a sent request against every quota, warns about thresholds crossed and
+// persists the usage.
+func (t *quotaTracker) take(now time.Time) {
+	t.mu.Lock()
+	if len(t.quotas) == 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	var warnings []QuotaStatus
+	usage := make(map[string]QuotaUsage, len(t.quotas))
+	for _, q := range t.quotas {
+		q.roll(now)
+		q.usage.Used++
+		usage[q.Name] = q.usage
+
+		crossed := false
+		for q.warned < len(q.Thresholds) && float64(q.usage.Used) >= q.Thresholds[q.warned]*float64(q.Limit) {
+			q.warned++
+			crossed = true
+		}
+		if crossed {
+			warnings = append(warnings, q.status())
+		}
+	}
+	if t.store != nil && t.loadErr == nil {
+		t.unsaved = usage
+		if !t.saving {
+			t.saving = true
+			go t.save()
+		}
+	}
+	onWarning := t.onWarning
+	t.mu.Unlock()
+
+	if onWarning != nil {
+		for _, w := range warnings {
+			onWarning(w)
+		}
+	}
+}
+
+// save gives the usage to the store until none is left unsaved. It runs in its own
+// goroutine so the dispatcher doesn't wait for the store; usage counted while a save is
+// in progress is saved in one go once it is done.
+func (t *quotaTracker) save() {
+	for {
+		t.mu.Lock()
+		usage, store, logger := t.unsaved, t.store, t.logger
+		t.unsaved = nil
+		if usage == nil || store == nil {
+			t.saving = false
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+
+		if err := store.Save(usage); err != nil && logger != nil {
+			logger.Error("Saving quota usage failed", "error", err)
+		}
+	}
+}
+
+// setLogger sets where failures to save the usage are logged.
+func (t *quotaTracker) setLogger(l Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logger = l
+}
+
+// statuses returns the usage of every quota.
+func (t *quotaTracker) statuses() []QuotaStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]QuotaStatus, 0, len(t.quotas))
+	for _, q := range t.quotas {
+		q.roll(now)
+		status := q.status()
+		status.Err = t.loadErr
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// SetQuotas limits the number of requests sent within the windows of the given quotas,
+// e.g. the daily cap of your plan. Usage is restored from and saved to store, which may
+// be nil if usage shouldn't survive a restart. Calling SetQuotas without quotas removes
+// all quotas.
+func (a *client) SetQuotas(store QuotaStore, quotas ...Quota) error {
+	return a.handler.quotas.set(store, quotas)
+}
+
+// OnQuotaWarning sets a function called whenever a quota crosses one of its thresholds.
+func (a *client) OnQuotaWarning(fn func(QuotaStatus)) {
+	a.handler.quotas.mu.Lock()
+	defer a.handler.quotas.mu.Unlock()
+	a.handler.quotas.onWarning = fn
+}
+
+// Quotas returns the usage and remaining budget of every quota. If the usage given to
+// WithQuotas couldn't be loaded, Err of every status says why.
+func (a *client) Quotas() []QuotaStatus {
+	return a.handler.quotas.statuses()
+}
@@ -0,0 +1,321 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQuotaWindowStart(t *testing.T) {
+	tests := []struct {
+		name   string
+		window time.Duration
+		now    time.Time
+		want   time.Time
+	}{
+		{"day", 24 * time.Hour,
+			time.Date(2024, 3, 5, 17, 30, 0, 0, time.UTC), time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"day at midnight", 24 * time.Hour,
+			time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"day in another zone", 24 * time.Hour,
+			time.Date(2024, 3, 5, 1, 0, 0, 0, time.FixedZone("CET", 3600)), time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"hour", time.Hour,
+			time.Date(2024, 3, 5, 17, 59, 59, 999, time.UTC), time.Date(2024, 3, 5, 17, 0, 0, 0, time.UTC)},
+		{"week", 7 * 24 * time.Hour, // The epoch was a Thursday.
+			time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &quotaState{Quota: Quota{Window: tt.window}}
+			if got := q.windowStart(tt.now); !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFileQuotaStore(t *testing.T) {
+	usage := map[string]QuotaUsage{
+		"daily": {WindowStart: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), Used: 42},
+	}
+
+	tests := []struct {
+		name     string
+		contents *string // Of the file before loading, nil if it doesn't exist.
+		dir      bool    // Whether the path is a directory, which can't be read.
+		want     map[string]QuotaUsage
+		wantErr  bool
+	}{
+		{"missing", nil, false, map[string]QuotaUsage{}, false},
+		{"saved", strPtr(`{"daily":{"window_start":"2024-03-05T00:00:00Z","used":42}}`), false, usage, false},
+		{"empty", strPtr(""), false, nil, true},
+		{"corrupt", strPtr(`{"daily":{"used":`), false, nil, true},
+		{"wrong type", strPtr(`{"daily":{"used":"many"}}`), false, nil, true},
+		{"unreadable", nil, true, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "quota.json")
+			if tt.contents != nil {
+				if err := ioutil.WriteFile(path, []byte(*tt.contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.dir {
+				if err := os.Mkdir(path, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := NewFileQuotaStore(path).Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileQuotaStoreRestart(t *testing.T) {
+	quota := Quota{Name: "daily", Limit: 100, Window: 24 * time.Hour}
+	current := (&quotaState{Quota: quota}).windowStart(time.Now())
+
+	tests := []struct {
+		name        string
+		windowStart time.Time // Of the saved usage.
+		wantUsed    int
+	}{
+		{"same window", current, 42},
+		{"previous window", current.Add(-quota.Window), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewFileQuotaStore(filepath.Join(t.TempDir(), "quota.json"))
+			if err := store.Save(map[string]QuotaUsage{"daily": {WindowStart: tt.windowStart, Used: 42}}); err != nil {
+				t.Fatal(err)
+			}
+
+			tracker := &quotaTracker{}
+			if err := tracker.set(store, []Quota{quota}); err != nil {
+				t.Fatal(err)
+			}
+			status := tracker.statuses()[0]
+			if status.Used != tt.wantUsed || !status.ResetsAt.Equal(current.Add(quota.Window)) {
+				t.Errorf("got %d used until %v, want %d until %v", status.Used, status.ResetsAt, tt.wantUsed, current.Add(quota.Window))
+			}
+		})
+	}
+}
+
+func TestSetQuotasLoadFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	if err := ioutil.WriteFile(path, []byte(`{"daily":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tracker := &quotaTracker{}
+	if err := tracker.set(NewFileQuotaStore(path), []Quota{{Name: "daily", Limit: 100, Window: time.Hour}}); err == nil {
+		t.Fatal("a corrupt file didn't fail SetQuotas")
+	}
+}
+
+func TestFileQuotaStoreSave(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileQuotaStore(filepath.Join(dir, "quota.json"))
+	usage := map[string]QuotaUsage{
+		"daily": {WindowStart: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), Used: 42},
+	}
+
+	for i := 0; i < 2; i++ { // The second save replaces the file.
+		if err := store.Save(usage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _ := store.Load()
+	if !reflect.DeepEqual(got, usage) {
+		t.Errorf("got %v, want %v", got, usage)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("got %d files, want only the store", len(files))
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// slowStore is a QuotaStore whose saves block until release is closed.
+type slowStore struct {
+	mu      sync.Mutex
+	saves   []map[string]QuotaUsage
+	release chan struct{}
+	err     error
+}
+
+func (s *slowStore) Load() (map[string]QuotaUsage, error) {
+	return map[string]QuotaUsage{}, nil
+}
+
+func (s *slowStore) Save(usage map[string]QuotaUsage) error {
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves = append(s.saves, usage)
+	return s.err
+}
+
+// recordingLogger is a Logger remembering the messages logged as errors.
+type recordingLogger struct {
+	nopLogger
+	mu     sync.Mutex
+	errors []string
+}
+
+func (l *recordingLogger) Error(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, msg)
+}
+
+func TestQuotaSaveAsync(t *testing.T) {
+	store := &slowStore{release: make(chan struct{}), err: errors.New("disk full")}
+	logger := &recordingLogger{}
+	tracker := &quotaTracker{}
+	tracker.setLogger(logger)
+	if err := tracker.set(store, []Quota{{Name: "daily", Limit: 100, Window: 24 * time.Hour}}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			tracker.take(time.Now())
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("take waited for the store")
+	}
+	close(store.release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		tracker.mu.Lock()
+		saving := tracker.saving
+		tracker.mu.Unlock()
+		if !saving {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the usage was never saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if n := len(store.saves); n == 0 || n > 2 {
+		t.Errorf("got %d saves, want the usage saved in at most 2", n)
+	}
+	if used := store.saves[len(store.saves)-1]["daily"].Used; used != 5 {
+		t.Errorf("last save has %d used, want 5", used)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if len(logger.errors) != len(store.saves) {
+		t.Errorf("logged %d errors for %d failed saves", len(logger.errors), len(store.saves))
+	}
+}
+
+func TestDeferredRequestsOutsideCapacity(t *testing.T) {
+	r := newTestHandler()
+	r.capacity = 2
+	r.overflow = OverflowFailFast
+	quota := Quota{Name: "daily", Limit: 10, Window: 24 * time.Hour, Reserve: 0.5, Policy: QuotaDefer}
+	if err := r.quotas.set(nil, []Quota{quota}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		r.quotas.take(time.Now()) // Down to the reserve.
+	}
+
+	var background []*request
+	for i := 0; i < 2; i++ {
+		background = append(background, r.addRequest(WithPriority(context.Background(), PriorityBackground), "", nil))
+	}
+	if req := r.addRequest(WithPriority(context.Background(), PriorityBackground), "", nil); !errors.Is((<-req.ch).err, ErrQueueFull) {
+		t.Fatal("the deferred requests grew past the capacity")
+	}
+	for i := 0; i < 2; i++ {
+		if req := r.addRequest(context.Background(), "", nil); len(req.ch) != 0 {
+			t.Fatalf("interactive request %d: %v", i, (<-req.ch).err)
+		}
+	}
+	if req := r.addRequest(context.Background(), "", nil); !errors.Is((<-req.ch).err, ErrQueueFull) {
+		t.Fatal("the deferred requests took room from the interactive ones")
+	}
+
+	for _, req := range background {
+		if len(req.ch) != 0 {
+			t.Fatalf("deferred request answered with %v", (<-req.ch).err)
+		}
+	}
+	if got := r.next(); got.priority != PriorityInteractive {
+		t.Fatalf("next returned a %v request while background is deferred", got.priority)
+	}
+}
+
+func TestShedSkipsDeferredRequests(t *testing.T) {
+	r := newTestHandler()
+	r.capacity = 2
+	r.overflow = OverflowShed
+	quota := Quota{Name: "daily", Limit: 10, Window: 24 * time.Hour, Reserve: 0.5, Policy: QuotaDefer}
+	if err := r.quotas.set(nil, []Quota{quota}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		r.quotas.take(time.Now()) // Down to the reserve.
+	}
+
+	background := r.addRequest(WithPriority(context.Background(), PriorityBackground), "", nil)
+	var live []*request
+	for i := 0; i < 2; i++ {
+		live = append(live, r.addRequest(WithPriority(context.Background(), PriorityLive), "", nil))
+	}
+	for i := 0; i < 2; i++ {
+		if req := r.addRequest(context.Background(), "", nil); len(req.ch) != 0 {
+			t.Fatalf("interactive request %d: %v", i, (<-req.ch).err)
+		}
+	}
+	for i, req := range live {
+		if res := <-req.ch; !errors.Is(res.err, ErrQueueFull) {
+			t.Fatalf("live request %d: got %v, want it shed", i, res.err)
+		}
+	}
+
+	if req := r.addRequest(context.Background(), "", nil); !errors.Is((<-req.ch).err, ErrQueueFull) {
+		t.Fatal("a deferred request was shed to make room that doesn't count")
+	}
+	if len(background.ch) != 0 {
+		t.Fatalf("the deferred request was answered with %v", (<-background.ch).err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if load := r.load(true); load != r.capacity {
+		t.Errorf("%d requests count against a capacity of %d", load, r.capacity)
+	}
+}
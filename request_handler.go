@@ -1,7 +1,10 @@
 package abios
 
 import (
+	"context"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
@@ -10,10 +13,17 @@ const (
 	default_requests_per_second = 5
 	default_requests_per_minute = 300
 
-	// Buffer one minutes worth of requests (this can not be changed at runtime)
+	// Buffer one minutes worth of requests by default (see SetQueueCapacity)
 	default_request_buffer_size = default_requests_per_minute
 )
 
+// Name of the histogram the time spent in the queue is reported as, in seconds.
+const (
+	metricQueueWait     = "abios_queue_wait_seconds"      // Labels: lane
+	metricQueueDepth    = "abios_queue_depth"             // Labels: lane
+	metricRateLimitWait = "abios_rate_limit_wait_seconds" // No labels.
+)
+
 // Parameters maps a key (string) to a list of values ([]string).
 type Parameters map[string][]string
 
@@ -33,32 +43,132 @@ func (p Parameters) Set(key, value string) {
 	p.Add(key, value)
 }
 
+// clone returns a copy of p that can be changed without changing p. The copy of a nil
+// Parameters is empty.
+func (p Parameters) clone() Parameters {
+	c := make(Parameters, len(p)+1)
+	for key, values := range p {
+		c[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
 // encode formats the string according to url.Values.Encode.
 func (p Parameters) encode() string {
 	v := url.Values(p)
 	return v.Encode()
 }
 
+// Priority decides which lane of the request queue a request waits in.
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // Someone is waiting for the response.
+	PriorityLive                        // Keeping live data up to date.
+	PriorityBackground                  // Crawls and other work that can wait.
+
+	numPriorities = 3
+)
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityLive:
+		return "live"
+	default:
+		return "background"
+	}
+}
+
+// laneWeights decides how the dispatcher shares the outgoing rate between the lanes when
+// more than one has requests waiting.
+var laneWeights = [numPriorities]int{
+	PriorityInteractive: 6,
+	PriorityLive:        3,
+	PriorityBackground:  1,
+}
+
+// Requests that have waited longer than this are dispatched before anything else,
+// regardless of lane, so a busy lane can't starve the others.
+const default_max_queue_wait = 30 * time.Second
+
+// priorityKey is the context key the request priority is stored under.
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx that makes requests performed with it wait in the
+// lane of the given priority. Requests without a priority are interactive.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityFrom returns the priority stored in ctx.
+func priorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && 0 <= p && p < numPriorities {
+		return p
+	}
+	return PriorityInteractive
+}
+
 // request is a logical container that groups which endpoint (as a complete url) to
 // target with what parameters as well as a channel on which the result will be available
 type request struct {
-	url    string
-	params Parameters
-	ch     chan result
+	ctx      context.Context
+	url      string
+	params   Parameters
+	ch       chan result
+	priority Priority
+	queuedAt time.Time
 }
 
 // result hold the returned data of an API request.
 type result struct {
 	statuscode int
 	body       []byte
+	header     http.Header
+	err        error // Set if the SDK itself failed the request.
+	transport  bool  // Set if no response was received, e.g. because of a network error.
+}
+
+// errorResult returns a result for a request the SDK failed with err.
+func errorResult(description string, err error) result {
+	return result{statuscode: 0, body: applicationError(description, err), err: err}
 }
 
+// OverflowPolicy decides what happens to a new request when the queue is full.
+type OverflowPolicy int
+
+const (
+	OverflowBlock    OverflowPolicy = iota // Wait until there is room in the queue.
+	OverflowFailFast                       // Fail the new request with ErrQueueFull.
+	OverflowShed                           // Fail the newest request of a lower priority lane instead.
+)
+
 // requestHandler buffers requests and sends them out at a user-specified rate.
 type requestHandler struct {
-	requests_per_second int              // How many requests can be performed per second.
-	requests_per_minute int              // How many requests can be performed per minute.
-	queue               chan *request    // The queue of requests.
-	override            responseOverride // Do we need to override the expected responses?
+	mu           sync.Mutex                // Guards the queue and the limiter.
+	lanes        [numPriorities][]*request // The queued requests, one queue per priority.
+	credits      [numPriorities]int        // Weighted round robin state of the lanes.
+	queued       int                       // Number of requests in all lanes.
+	capacity     int                       // Maximum number of queued requests.
+	overflow     OverflowPolicy            // What to do when the queue is full.
+	space        chan struct{}             // Closed and replaced when room is made in the queue.
+	pending      chan struct{}             // Signalled when a request is queued.
+	maxQueueWait time.Duration             // When the starvation guard kicks in.
+	overrideMu   sync.Mutex                // Guards override, which the authenticator sets.
+	override     responseOverride          // Do we need to override the expected responses?
+	limiter      Limiter                   // Decides when the next request may be sent.
+	quotas       *quotaTracker             // Counts requests against quotas.
+	adaptive     *adaptiveRate             // Lowers the rate when the API asks us to.
+	breaker      *circuitBreaker           // Fails requests fast while the API is down.
+	pipeline     *pipeline                 // Middleware and http client requests are sent through.
+	hooksMu      sync.RWMutex              // Guards metrics, logger and tracer, which can be replaced at any time.
+	metrics      Metrics                   // Where queue measurements are reported.
+	logger       Logger
+	tracer       Tracer
+	health       *healthState // Token expiry and last success, reported by Health.
+	strict       uint32       // Non-zero if responses are decoded strictly, accessed atomically.
 }
 
 // responseOverride is a struct containing the logic of overriding responses.
@@ -68,97 +178,520 @@ type responseOverride struct {
 	data     result // The data we should return instead.
 }
 
-// addRequest creates and adds a Request to the requestHandler queue. It returns
-// the channel on which the result will eventually be available.
-func (r *requestHandler) addRequest(url string, params Parameters) chan result {
-	returnCh := make(chan result)
-	req := request{url, params, returnCh}
-	r.queue <- &req
-	return returnCh
+// getOverride returns the current response override.
+func (r *requestHandler) getOverride() responseOverride {
+	r.overrideMu.Lock()
+	defer r.overrideMu.Unlock()
+	return r.override
+}
+
+// setOverride replaces the response override.
+func (r *requestHandler) setOverride(o responseOverride) {
+	r.overrideMu.Lock()
+	defer r.overrideMu.Unlock()
+	r.override = o
+}
+
+// addRequest creates and adds a Request to the requestHandler queue. It returns the
+// request, whose channel the result will eventually be available on; use await to wait
+// for it. The lane is decided by the priority of ctx. What happens when the queue is
+// full is decided by the overflow policy.
+func (r *requestHandler) addRequest(ctx context.Context, url string, params Parameters) *request {
+	returnCh := make(chan result, 1)
+	req := &request{
+		ctx:      ctx,
+		url:      url,
+		params:   params,
+		ch:       returnCh,
+		priority: priorityFrom(ctx),
+		queuedAt: time.Now(),
+	}
+
+	if r.breaker.rejects(req.queuedAt) {
+		returnCh <- errorResult("the API appears to be down", ErrCircuitOpen)
+		return req
+	}
+
+	if blocked, refuse := r.quotas.blocked(req.priority, req.queuedAt); blocked && refuse {
+		returnCh <- errorResult("request would exceed quota", ErrQuotaExceeded)
+		return req
+	}
+
+	for {
+		parked := r.parked(time.Now())
+		r.mu.Lock()
+		if r.fits(req, parked) {
+			r.enqueue(req)
+			r.mu.Unlock()
+			r.reportQueueDepth()
+			return req
+		}
+
+		switch r.overflow {
+		case OverflowFailFast:
+			r.mu.Unlock()
+			returnCh <- errorResult("request queue is full", ErrQueueFull)
+			return req
+		case OverflowShed:
+			victim := r.shed(req.priority, parked)
+			if victim == nil {
+				r.mu.Unlock()
+				returnCh <- errorResult("request queue is full", ErrQueueFull)
+				return req
+			}
+			r.enqueue(req)
+			r.mu.Unlock()
+			r.reportQueueDepth()
+			victim.ch <- errorResult("request was shed from a full queue", ErrQueueFull)
+			return req
+		}
+
+		space := r.space
+		r.mu.Unlock()
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			returnCh <- errorResult("request was cancelled before being queued", ctx.Err())
+			return req
+		}
+	}
+}
+
+// await returns the result of req. If the context of req is done first the request is
+// taken out of the queue, so it doesn't use up a slot of the outgoing rate, and the
+// returned result describes the cancellation. A request that is already being sent is
+// waited for, its http request is cancelled by the same context.
+func (r *requestHandler) await(req *request) result {
+	select {
+	case res := <-req.ch:
+		return res
+	case <-req.ctx.Done():
+	}
+
+	r.mu.Lock()
+	removed := r.remove(req)
+	r.mu.Unlock()
+
+	if !removed {
+		return <-req.ch
+	}
+	r.reportQueueDepth()
+	return errorResult("request was cancelled while queued", req.ctx.Err())
+}
+
+// remove takes req out of its lane and reports whether it was queued. Must be called
+// with r.mu held.
+func (r *requestHandler) remove(req *request) bool {
+	lane := r.lanes[req.priority]
+	for i, queued := range lane {
+		if queued != req {
+			continue
+		}
+		copy(lane[i:], lane[i+1:])
+		lane[len(lane)-1] = nil
+		r.lanes[req.priority] = lane[:len(lane)-1]
+		if len(r.lanes[req.priority]) == 0 {
+			r.credits[req.priority] = 0
+		}
+		r.queued--
+		r.madeSpace()
+		return true
+	}
+	return false
+}
+
+// parked reports whether the background lane is deferred by a quota. The requests in it
+// then wait outside the capacity the other lanes share, so they can't make other
+// callers block until the quota resets.
+func (r *requestHandler) parked(now time.Time) bool {
+	blocked, refuse := r.quotas.blocked(PriorityBackground, now)
+	return blocked && !refuse
+}
+
+// load returns the number of queued requests that count against the capacity. Must be
+// called with r.mu held.
+func (r *requestHandler) load(parked bool) int {
+	if parked {
+		return r.queued - len(r.lanes[PriorityBackground])
+	}
+	return r.queued
+}
+
+// fits reports whether there is room in the queue for req. Deferred background requests
+// have a capacity of their own, so they don't take room from other callers but can't
+// grow without bound either. Must be called with r.mu held.
+func (r *requestHandler) fits(req *request, parked bool) bool {
+	if parked && req.priority == PriorityBackground {
+		return len(r.lanes[PriorityBackground]) < r.capacity
+	}
+	return r.load(parked) < r.capacity
+}
+
+// enqueue adds req to the lane of its priority and wakes up the dispatcher. Must be
+// called with r.mu held.
+func (r *requestHandler) enqueue(req *request) {
+	r.lanes[req.priority] = append(r.lanes[req.priority], req)
+	r.queued++
+
+	select {
+	case r.pending <- struct{}{}:
+	default:
+	}
+}
+
+// next removes and returns the request to dispatch next, blocking until there is one.
+// Requests whose context is done are answered with an error and skipped.
+func (r *requestHandler) next() *request {
+	for {
+		now := time.Now()
+
+		// Lanes deferred by a quota are left alone until it resets.
+		var deferred [numPriorities]bool
+		for p := range deferred {
+			blocked, refuse := r.quotas.blocked(Priority(p), now)
+			deferred[p] = blocked && !refuse
+		}
+
+		r.mu.Lock()
+		if deferred[PriorityBackground] && len(r.lanes[PriorityBackground]) > 0 {
+			r.madeSpace() // The deferred requests no longer count against the capacity.
+		}
+		req := r.pick(now, deferred)
+		r.mu.Unlock()
+
+		if req == nil {
+			select {
+			case <-r.pending:
+			case <-time.After(time.Second): // A quota may have reset.
+			}
+			continue
+		}
+
+		r.reportQueueDepth()
+		r.getMetrics().Observe(metricQueueWait, time.Since(req.queuedAt).Seconds(), Labels{"lane": req.priority.String()})
+
+		if err := req.ctx.Err(); err != nil {
+			req.ch <- errorResult("request was cancelled while queued", err)
+			continue
+		}
+
+		if blocked, _ := r.quotas.blocked(req.priority, now); blocked {
+			req.ch <- errorResult("request would exceed quota", ErrQuotaExceeded)
+			continue
+		}
+
+		return req
+	}
+}
+
+// pick removes the next request from the lanes, or returns nil if they are all empty
+// or skipped. A request that has waited longer than maxQueueWait goes first. Otherwise
+// the lanes are served by smooth weighted round robin among the lanes that have requests
+// waiting. Must be called with r.mu held.
+func (r *requestHandler) pick(now time.Time, skip [numPriorities]bool) *request {
+	chosen := -1
+	for p := range r.lanes {
+		if len(r.lanes[p]) == 0 || skip[p] {
+			continue
+		}
+		head := r.lanes[p][0]
+		if now.Sub(head.queuedAt) > r.maxQueueWait &&
+			(chosen == -1 || head.queuedAt.Before(r.lanes[chosen][0].queuedAt)) {
+			chosen = p
+		}
+	}
+
+	if chosen == -1 {
+		total := 0
+		for p := range r.lanes {
+			if len(r.lanes[p]) == 0 || skip[p] {
+				continue
+			}
+			r.credits[p] += laneWeights[p]
+			total += laneWeights[p]
+			if chosen == -1 || r.credits[p] > r.credits[chosen] {
+				chosen = p
+			}
+		}
+		if chosen == -1 {
+			return nil
+		}
+		r.credits[chosen] -= total
+	}
+
+	req := r.lanes[chosen][0]
+	r.lanes[chosen][0] = nil
+	r.lanes[chosen] = r.lanes[chosen][1:]
+	if len(r.lanes[chosen]) == 0 {
+		r.credits[chosen] = 0 // An idle lane doesn't save up credit.
+	}
+	r.queued--
+	r.madeSpace()
+	return req
+}
+
+// madeSpace wakes up everyone waiting for room in the queue. Must be called with r.mu
+// held.
+func (r *requestHandler) madeSpace() {
+	close(r.space)
+	r.space = make(chan struct{})
+}
+
+// rejectQueued empties every lane, answering each request with res.
+func (r *requestHandler) rejectQueued(res result) {
+	var rejected []*request
+	r.mu.Lock()
+	for p := range r.lanes {
+		rejected = append(rejected, r.lanes[p]...)
+		r.lanes[p] = nil
+		r.credits[p] = 0
+	}
+	r.queued = 0
+	r.madeSpace()
+	r.mu.Unlock()
+
+	r.reportQueueDepth()
+	for _, req := range rejected {
+		req.ch <- res
+	}
+}
+
+// shed removes and returns the newest request in the lowest priority lane below p, or
+// nil if all those lanes are empty. A parked background lane doesn't count against the
+// capacity, so shedding from it makes no room and it is skipped. Must be called with
+// r.mu held.
+func (r *requestHandler) shed(p Priority, parked bool) *request {
+	for q := numPriorities - 1; q > int(p); q-- {
+		if parked && Priority(q) == PriorityBackground {
+			continue
+		}
+		if n := len(r.lanes[q]); n > 0 {
+			victim := r.lanes[q][n-1]
+			r.lanes[q][n-1] = nil
+			r.lanes[q] = r.lanes[q][:n-1]
+			r.queued--
+			return victim
+		}
+	}
+	return nil
+}
+
+// setQueueCapacity sets how many requests can be queued. 0 or less means do nothing.
+func (r *requestHandler) setQueueCapacity(capacity int) {
+	if capacity <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.capacity = capacity
+	r.madeSpace()
+}
+
+// queueCapacity returns how many requests can be queued.
+func (r *requestHandler) queueCapacity() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.capacity
+}
+
+// setOverflowPolicy sets what happens to new requests when the queue is full.
+func (r *requestHandler) setOverflowPolicy(policy OverflowPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overflow = policy
+}
+
+// estimateWait estimates how long a request with priority p queued now would wait
+// before it is dispatched. The requests ahead of it are those in its own lane plus the
+// share of every other lane the weighted round robin serves in the meantime.
+func (r *requestHandler) estimateWait(p Priority) time.Duration {
+	if p < 0 || numPriorities <= p {
+		p = PriorityBackground
+	}
+
+	r.mu.Lock()
+	own := float64(len(r.lanes[p]) + 1)
+	ahead := own
+	for q := range r.lanes {
+		if Priority(q) == p {
+			continue
+		}
+		share := own * float64(laneWeights[q]) / float64(laneWeights[p])
+		if depth := float64(len(r.lanes[q])); depth < share {
+			share = depth
+		}
+		ahead += share
+	}
+	r.mu.Unlock()
+
+	second, minute := r.rate()
+	perSecond := float64(second)
+	if perMinute := float64(minute) / 60; perMinute < perSecond {
+		perSecond = perMinute
+	}
+
+	return time.Duration((ahead - 1) / perSecond * float64(time.Second))
+}
+
+// queueDepth returns the number of requests waiting in each lane.
+func (r *requestHandler) queueDepth() map[Priority]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	depth := make(map[Priority]int, numPriorities)
+	for p := range r.lanes {
+		depth[Priority(p)] = len(r.lanes[p])
+	}
+	return depth
+}
+
+// reportQueueDepth reports the number of requests waiting in each lane.
+func (r *requestHandler) reportQueueDepth() {
+	for p, n := range r.queueDepth() {
+		r.getMetrics().Set(metricQueueDepth, float64(n), Labels{"lane": p.String()})
+	}
 }
 
 // newRequestHandler creates a new requestHandler and starts the dispatcher
 // goroutine.
 func newRequestHandler() *requestHandler {
 	h := &requestHandler{
-		default_requests_per_second,
-		default_requests_per_minute,
-		make(chan *request, default_request_buffer_size),
-		responseOverride{
+		limiter:      NewLimiter(default_requests_per_second, default_requests_per_minute),
+		capacity:     default_request_buffer_size,
+		overflow:     OverflowBlock,
+		space:        make(chan struct{}),
+		pending:      make(chan struct{}, 1),
+		maxQueueWait: default_max_queue_wait,
+		override: responseOverride{
 			override: false,
 			data:     result{},
 		},
+		metrics:  nopMetrics{},
+		quotas:   &quotaTracker{},
+		adaptive: newAdaptiveRate(),
+		breaker:  newCircuitBreaker(),
+		pipeline: newPipeline(),
+		logger:   nopLogger{},
+		tracer:   nopTracer{},
+		health:   &healthState{},
 	}
 
 	go h.dispatcher()
 	return h
 }
 
-// SetRate sets the outgoing rate according to the give parameters. 0 or less means do nothing.
+// setRate sets the outgoing rate if the limiter supports it.
 func (r *requestHandler) setRate(second, minute int) {
-	if 0 < second {
-		r.requests_per_second = second
+	if l, ok := r.getLimiter().(rateLimiter); ok {
+		l.SetRate(second, minute)
 	}
+}
 
-	if 0 < minute {
-		r.requests_per_minute = minute
+// rate returns the current outgoing rate, or the default rate if the limiter can't
+// tell.
+func (r *requestHandler) rate() (second, minute int) {
+	if l, ok := r.getLimiter().(rateLimiter); ok {
+		return l.Rate()
 	}
+	return default_requests_per_second, default_requests_per_minute
+}
 
-	// Make sure they are consistent
-	if r.requests_per_second > r.requests_per_minute {
-		r.requests_per_second = r.requests_per_minute
-	}
+// setLimiter replaces the limiter requests wait for.
+func (r *requestHandler) setLimiter(l Limiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiter = l
+}
 
+// getLimiter returns the limiter requests wait for.
+func (r *requestHandler) getLimiter() Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.limiter
 }
 
-// dispatcher does requestHandler.Rate api-calls every requestHandler.ResetInterval
-func (r *requestHandler) dispatcher() {
-	var requests_this_second, requests_this_minute int
-	ok := make(chan int, default_request_buffer_size)
+// getMetrics returns the Metrics set by SetMetrics.
+func (r *requestHandler) getMetrics() Metrics {
+	r.hooksMu.RLock()
+	defer r.hooksMu.RUnlock()
+	return r.metrics
+}
 
-	ticker_second := time.NewTicker(time.Second)
-	ticker_minute := time.NewTicker(time.Minute)
+// getLogger returns the Logger set by SetLogger.
+func (r *requestHandler) getLogger() Logger {
+	r.hooksMu.RLock()
+	defer r.hooksMu.RUnlock()
+	return r.logger
+}
 
+// getTracer returns the Tracer set by SetTracer.
+func (r *requestHandler) getTracer() Tracer {
+	r.hooksMu.RLock()
+	defer r.hooksMu.RUnlock()
+	return r.tracer
+}
+
+// awaitRequest blocks until at least one request is queued.
+func (r *requestHandler) awaitRequest() {
 	for {
-		select {
-		//case <-ticker_day.C: // Example of how to add more time-frames
-		//	// Allow for more requests!
-		//	requests_today = 0
-		case <-ticker_minute.C:
-			//if requests_today < r.requests_per_day // Also example
-			// Allow for more requests this minute if we still have requests left today
-			requests_this_minute = 0
-		case <-ticker_second.C:
-			// Allow for more requests this second if we still have requests left this minute
-			if requests_this_minute < r.requests_per_minute {
-				go func() {
-					loop_counter := r.requests_per_minute - requests_this_minute // requests left this minute
-
-					// If requests_per_second is smaller than requets left this minute, set loop counter
-					// to the smaller of the values
-					if r.requests_per_second < loop_counter {
-						loop_counter = r.requests_per_second
-					}
-
-					for i := 0; i < loop_counter; i++ {
-						ok <- 1
-					}
-				}()
-			}
-		case <-ok:
-			currentRequest := <-r.queue
-			re := result{}
-
-			// Do we have to override the response?
-			if r.override.override {
-				currentRequest.ch <- r.override.data
-			} else {
-				re.statuscode, re.body = performRequest(currentRequest.url, currentRequest.params)
-				currentRequest.ch <- re
-			}
+		r.mu.Lock()
+		queued := r.queued
+		r.mu.Unlock()
+
+		if 0 < queued {
+			return
+		}
+		<-r.pending
+	}
+}
+
+// dispatcher sends the queued requests one at a time as fast as the limiter allows.
+// The request to send is picked after the limiter lets us through, so a request queued
+// in a higher priority lane while we wait still goes first.
+func (r *requestHandler) dispatcher() {
+	for {
+		r.awaitRequest()
+
+		// The breaker would reject the queued requests once the limiter lets them
+		// through, so fail them now instead of using up the rate on them.
+		if r.breaker.rejects(time.Now()) {
+			r.rejectQueued(errorResult("the API appears to be down", ErrCircuitOpen))
+			continue
+		}
+
+		waitStart := time.Now()
+		second, minute := r.rate()
+		if err := r.adaptive.wait(context.Background(), second, minute); err != nil {
+			continue
+		}
+
+		if err := r.getLimiter().Wait(context.Background()); err != nil {
+			// E.g. a shared limiter failing to reach its store. Don't spin.
+			time.Sleep(time.Second)
+			continue
+		}
+
+		r.getMetrics().Observe(metricRateLimitWait, time.Since(waitStart).Seconds(), nil)
+
+		currentRequest := r.next()
+		r.traceWaits(currentRequest, waitStart, time.Now())
+		re := result{}
 
-			requests_this_second += 1
-			requests_this_minute += 1
+		// Do we have to override the response?
+		if o := r.getOverride(); o.override {
+			currentRequest.ch <- o.data
+		} else if !r.breaker.allow(time.Now()) {
+			currentRequest.ch <- errorResult("the API appears to be down", ErrCircuitOpen)
+		} else {
+			r.quotas.take(time.Now())
+			ctx, span := startHTTP(r.getTracer(), currentRequest.ctx, "GET", currentRequest.url)
+			re = r.pipeline.performRequest(ctx, currentRequest.url, currentRequest.params)
+			endHTTP(span, re)
+			r.adaptive.observe(re, second, minute)
+			r.breaker.record(currentRequest.ctx, re, time.Now())
+			r.health.observe(re)
+			currentRequest.ch <- re
 		}
 	}
 }
@@ -0,0 +1,230 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestHandler returns a requestHandler without a dispatcher, so tests decide when
+// requests leave the queue.
+func newTestHandler() *requestHandler {
+	return &requestHandler{
+		limiter:      NewLimiter(default_requests_per_second, default_requests_per_minute),
+		capacity:     default_request_buffer_size,
+		overflow:     OverflowBlock,
+		space:        make(chan struct{}),
+		pending:      make(chan struct{}, 1),
+		maxQueueWait: default_max_queue_wait,
+		metrics:      nopMetrics{},
+		quotas:       &quotaTracker{},
+		adaptive:     newAdaptiveRate(),
+		breaker:      newCircuitBreaker(),
+		pipeline:     newPipeline(),
+		logger:       nopLogger{},
+		tracer:       nopTracer{},
+		health:       &healthState{},
+	}
+}
+
+// queue adds a request with the given priority, queued the given time ago.
+func queue(r *requestHandler, p Priority, age time.Duration) *request {
+	req := r.addRequest(WithPriority(context.Background(), p), "", nil)
+	req.queuedAt = time.Now().Add(-age)
+	return req
+}
+
+func TestPickWeightedRoundRobin(t *testing.T) {
+	tests := []struct {
+		name  string
+		lanes [numPriorities]int // Requests queued in each lane.
+		skip  [numPriorities]bool
+		want  []Priority
+	}{
+		{"one lane", [numPriorities]int{0, 0, 3}, [numPriorities]bool{},
+			[]Priority{PriorityBackground, PriorityBackground, PriorityBackground}},
+		{"all lanes", [numPriorities]int{10, 10, 10}, [numPriorities]bool{},
+			[]Priority{0, 1, 0, 0, 1, 0, 2, 0, 1, 0}},
+		{"interactive and background", [numPriorities]int{10, 0, 10}, [numPriorities]bool{},
+			[]Priority{0, 0, 0, 2, 0, 0, 0}},
+		{"skipped lane", [numPriorities]int{2, 0, 2}, [numPriorities]bool{PriorityInteractive: true},
+			[]Priority{2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestHandler()
+			for p, n := range tt.lanes {
+				for i := 0; i < n; i++ {
+					queue(r, Priority(p), 0)
+				}
+			}
+
+			now := time.Now()
+			for i, want := range tt.want {
+				req := r.pick(now, tt.skip)
+				if req == nil {
+					t.Fatalf("pick %d: got nil, want %v", i, want)
+				}
+				if req.priority != want {
+					t.Fatalf("pick %d: got %v, want %v", i, req.priority, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPickStarvationGuard(t *testing.T) {
+	r := newTestHandler()
+	for i := 0; i < 5; i++ {
+		queue(r, PriorityInteractive, 0)
+	}
+	old := queue(r, PriorityBackground, 2*default_max_queue_wait)
+
+	if req := r.pick(time.Now(), [numPriorities]bool{}); req != old {
+		t.Fatalf("got %v request, want the background request that waited longest", req.priority)
+	}
+}
+
+func TestPickEmpty(t *testing.T) {
+	r := newTestHandler()
+	queue(r, PriorityLive, 0)
+
+	if req := r.pick(time.Now(), [numPriorities]bool{PriorityLive: true}); req != nil {
+		t.Fatalf("got %v request from a skipped lane", req.priority)
+	}
+	if r.queued != 1 {
+		t.Fatalf("queued = %d, want 1", r.queued)
+	}
+}
+
+func TestNextSkipsCancelled(t *testing.T) {
+	r := newTestHandler()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := r.addRequest(ctx, "", nil)
+	cancel()
+	live := r.addRequest(context.Background(), "", nil)
+
+	if req := r.next(); req != live {
+		t.Fatal("next returned the cancelled request")
+	}
+	res := <-cancelled.ch
+	if !errors.Is(res.err, context.Canceled) {
+		t.Fatalf("cancelled request got %v, want context.Canceled", res.err)
+	}
+}
+
+func TestAwaitRemovesCancelled(t *testing.T) {
+	r := newTestHandler()
+	ctx, cancel := context.WithCancel(context.Background())
+	req := r.addRequest(ctx, "", nil)
+	other := r.addRequest(context.Background(), "", nil)
+
+	done := make(chan result)
+	go func() { done <- r.await(req) }()
+	cancel()
+
+	select {
+	case res := <-done:
+		if !errors.Is(res.err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", res.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("await didn't return after the context was cancelled")
+	}
+
+	if r.queued != 1 || len(r.lanes[PriorityInteractive]) != 1 || r.lanes[PriorityInteractive][0] != other {
+		t.Fatalf("the cancelled request is still queued: %d queued", r.queued)
+	}
+}
+
+func TestAwaitDispatched(t *testing.T) {
+	r := newTestHandler()
+	ctx, cancel := context.WithCancel(context.Background())
+	req := r.addRequest(ctx, "", nil)
+	r.next() // The dispatcher has taken the request.
+	cancel()
+
+	go func() { req.ch <- result{statuscode: 200} }()
+	if res := r.await(req); res.statuscode != 200 {
+		t.Fatalf("got status %d, want the result of the dispatched request", res.statuscode)
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   OverflowPolicy
+		queued   Priority // The request filling the queue.
+		added    Priority
+		wantNew  error // What the new request fails with, nil if it is queued.
+		wantShed bool  // Whether the queued request is shed.
+	}{
+		{"fail fast", OverflowFailFast, PriorityBackground, PriorityLive, ErrQueueFull, false},
+		{"shed lower lane", OverflowShed, PriorityBackground, PriorityLive, nil, true},
+		{"shed same lane", OverflowShed, PriorityLive, PriorityLive, ErrQueueFull, false},
+		{"shed higher lane", OverflowShed, PriorityLive, PriorityBackground, ErrQueueFull, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestHandler()
+			r.capacity = 1
+			r.overflow = tt.policy
+			queued := queue(r, tt.queued, 0)
+			added := queue(r, tt.added, 0)
+
+			if tt.wantNew != nil {
+				if res := <-added.ch; !errors.Is(res.err, tt.wantNew) {
+					t.Fatalf("new request got %v, want %v", res.err, tt.wantNew)
+				}
+			} else if r.queued != 1 || r.lanes[tt.added][0] != added {
+				t.Fatal("the new request isn't queued")
+			}
+
+			select {
+			case res := <-queued.ch:
+				if !tt.wantShed || !errors.Is(res.err, ErrQueueFull) {
+					t.Fatalf("queued request got %v", res.err)
+				}
+			default:
+				if tt.wantShed {
+					t.Fatal("the queued request wasn't shed")
+				}
+			}
+		})
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	r := newTestHandler()
+	r.capacity = 1
+	first := queue(r, PriorityInteractive, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := <-r.addRequest(ctx, "", nil).ch; !errors.Is(res.err, context.Canceled) {
+		t.Fatalf("cancelled request got %v, want context.Canceled", res.err)
+	}
+
+	added := make(chan *request)
+	go func() { added <- r.addRequest(context.Background(), "", nil) }()
+	select {
+	case <-added:
+		t.Fatal("the request was queued in a full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if req := r.next(); req != first {
+		t.Fatal("next didn't return the first request")
+	}
+	select {
+	case req := <-added:
+		if r.next() != req {
+			t.Fatal("the blocked request isn't queued")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the request wasn't queued once there was room")
+	}
+}
@@ -1,423 +1,217 @@
 package abios
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"strconv"
 
+	"github.com/PatronGG/abios-go-sdk/internal/subscription"
 	. "github.com/PatronGG/abios-go-sdk/structs"
 	"github.com/gobuffalo/uuid"
 )
 
+// get queries endpoint with params, or no parameters if params is nil, and decodes the
+// response into a T. Every REST endpoint goes through it, so the access token, the
+// queue, tracing and decode errors are handled the same way for all of them. The
+// request waits in the lane of the priority of ctx and is given up if ctx is done. The
+// error unwraps to the Err of the ErrorStruct describing it, e.g. a *DecodeError, and
+// errorStruct returns the ErrorStruct itself.
+func get[T any](ctx context.Context, a *client, endpoint string, params Parameters) (T, error) {
+	var target T
+	params = params.clone()
+	params.Set("access_token", a.oauth.get().AccessToken)
+	ctx, span := a.startCall(ctx, endpoint, params)
+	defer endSpan(span)
+	result := a.handler.await(a.handler.addRequest(ctx, endpoint, params))
+
+	if result.statuscode < 200 || 300 <= result.statuscode {
+		return target, &requestError{err: callError(span, result), status: result.statuscode}
+	}
+	if derr := a.decode(ctx, span, endpoint, result.body, &target); derr != nil {
+		var zero T
+		return zero, &requestError{err: errorFromResult(errorResult("when decoding response", derr))}
+	}
+	return target, nil
+}
+
+// fetch performs get with the context of a, naming the call method in its span, and
+// returns the error as the ErrorStruct the endpoint methods return.
+func fetch[T any](a *client, method, endpoint string, params Parameters) (T, *ErrorStruct) {
+	target, err := get[T](withCall(a.ctx, method), a, endpoint, params)
+	return target, errorStruct(err)
+}
+
 // Games queries the /games endpoint and returns a GameStructPaginated.
 func (a *client) Games(params Parameters) (GameStructPaginated, *ErrorStruct) {
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(games, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := GameStructPaginated{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(target)
-		return GameStructPaginated{}, &target
-	}
-
-	return GameStructPaginated{}, &ErrorStruct{}
+	return fetch[GameStructPaginated](a, "Games", games, params)
 }
 
 // Series queries the /series endpoint and returns a SeriesStructPaginated.
 func (a *client) Series(params Parameters) (SeriesStructPaginated, *ErrorStruct) {
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(series, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := SeriesStructPaginated{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return SeriesStructPaginated{}, &target
-	}
-
-	return SeriesStructPaginated{}, &ErrorStruct{}
+	return fetch[SeriesStructPaginated](a, "Series", series, params)
 }
 
 // SeriesById queries the /series/:id endpoint and returns a SeriesStruct.
 func (a *client) SeriesById(id int, params Parameters) (SeriesStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(seriesById+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := SeriesStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return SeriesStruct{}, &target
-	}
-
-	return SeriesStruct{}, &ErrorStruct{}
+	return fetch[SeriesStruct](a, "SeriesById", seriesById+strconv.Itoa(id), params)
 }
 
 // MatchesById queries the /matches/:id endpoint and returns a MatchStruct.
 func (a *client) MatchesById(id int, params Parameters) (MatchStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(matches+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := MatchStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return MatchStruct{}, &target
-	}
-
-	return MatchStruct{}, &ErrorStruct{}
+	return fetch[MatchStruct](a, "MatchesById", matches+strconv.Itoa(id), params)
 }
 
 // Tournaments queries the /tournaments endpoint and returns a list of TournamentStructPaginated.
 func (a *client) Tournaments(params Parameters) (TournamentStructPaginated, *ErrorStruct) {
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(tournaments, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := TournamentStructPaginated{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return TournamentStructPaginated{}, &target
-	}
-
-	return TournamentStructPaginated{}, &ErrorStruct{}
+	return fetch[TournamentStructPaginated](a, "Tournaments", tournaments, params)
 }
 
 // TournamentsById queries the /tournaments/:id endpoint and return a TournamentStruct.
 func (a *client) TournamentsById(id int, params Parameters) (TournamentStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(tournamentsById+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := TournamentStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return TournamentStruct{}, &target
-	}
-
-	return TournamentStruct{}, &ErrorStruct{}
+	return fetch[TournamentStruct](a, "TournamentsById", tournamentsById+strconv.Itoa(id), params)
 }
 
 // SubstagesById queries the /substages/:id endpoint and returns a SubstageStruct.
 func (a *client) SubstagesById(id int, params Parameters) (SubstageStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(substages+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := SubstageStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return SubstageStruct{}, &target
-	}
-
-	return SubstageStruct{}, &ErrorStruct{}
+	return fetch[SubstageStruct](a, "SubstagesById", substages+strconv.Itoa(id), params)
 }
 
 // Teams queries the /teams endpoint and returns a TeamsStructPaginated.
 func (a *client) Teams(params Parameters) (TeamStructPaginated, *ErrorStruct) {
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(teams, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := TeamStructPaginated{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return TeamStructPaginated{}, &target
-	}
-
-	return TeamStructPaginated{}, &ErrorStruct{}
+	return fetch[TeamStructPaginated](a, "Teams", teams, params)
 }
 
 // TeamsById queues the /teams/:id endpoint and return a TeamStruct.
 func (a *client) TeamsById(id int, params Parameters) (TeamStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(teamsById+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := TeamStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return TeamStruct{}, &target
-	}
-
-	return TeamStruct{}, &ErrorStruct{}
+	return fetch[TeamStruct](a, "TeamsById", teamsById+strconv.Itoa(id), params)
 }
 
 // Players queries the /players endpoint and returns PlayerStructPaginated.
 func (a *client) Players(params Parameters) (PlayerStructPaginated, *ErrorStruct) {
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(players, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := PlayerStructPaginated{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return PlayerStructPaginated{}, &target
-	}
-
-	return PlayerStructPaginated{}, &ErrorStruct{}
+	return fetch[PlayerStructPaginated](a, "Players", players, params)
 }
 
 // PlayersById queries the /players/:id endpoint and returns a PlayerStruct.
 func (a *client) PlayersById(id int, params Parameters) (PlayerStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(playersById+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := PlayerStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return PlayerStruct{}, &target
-	}
-
-	return PlayerStruct{}, &ErrorStruct{}
+	return fetch[PlayerStruct](a, "PlayersById", playersById+strconv.Itoa(id), params)
 }
 
 // RostersById queries the /rosters/:id endpoint and returns a RosterStruct.
 func (a *client) RostersById(id int, params Parameters) (RosterStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(rosters+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := RosterStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return RosterStruct{}, &target
-	}
-
-	return RosterStruct{}, &ErrorStruct{}
+	return fetch[RosterStruct](a, "RostersById", rosters+strconv.Itoa(id), params)
 }
 
 // Search queries the /search endpoint with the given query and returns a list of
 // SearchResultStruct.
 func (a *client) Search(query string, params Parameters) ([]SearchResultStruct, *ErrorStruct) {
-	params.Set("access_token", a.oauth.AccessToken)
+	params = params.clone()
 	params.Add("q", query)
-	result := <-a.handler.addRequest(search, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := []SearchResultStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return []SearchResultStruct{}, &target
-	}
-
-	return []SearchResultStruct{}, &ErrorStruct{}
+	return fetch[[]SearchResultStruct](a, "Search", search, params)
 }
 
 // Incidents queries the /incidents endpoint and returns an IncidentStructPaginated.
 func (a *client) Incidents(params Parameters) (IncidentStructPaginated, *ErrorStruct) {
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(incidents, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := IncidentStructPaginated{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return IncidentStructPaginated{}, &target
-	}
-
-	return IncidentStructPaginated{}, &ErrorStruct{}
+	return fetch[IncidentStructPaginated](a, "Incidents", incidents, params)
 }
 
 // IncidentBySeriesId queries the /incidents/:series_id endpoint and returns a
 // SeriesIncidentsStruct.
 func (a *client) IncidentsBySeriesId(id int) (SeriesIncidentsStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	params := make(Parameters)
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(incidentsBySeries+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := SeriesIncidentsStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return SeriesIncidentsStruct{}, &target
-	}
-
-	return SeriesIncidentsStruct{}, &ErrorStruct{}
+	return fetch[SeriesIncidentsStruct](a, "IncidentsBySeriesId", incidentsBySeries+strconv.Itoa(id), nil)
 }
 
 // Organisations queries the /organisations endpoint and returns a OrganisationStructPaginated
 func (a *client) Organisations(params Parameters) (OrganisationStructPaginated, *ErrorStruct) {
-	if params == nil {
-		params = make(Parameters)
-	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(organisations, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := OrganisationStructPaginated{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return OrganisationStructPaginated{}, &target
-	}
-
-	return OrganisationStructPaginated{}, &ErrorStruct{}
+	return fetch[OrganisationStructPaginated](a, "Organisations", organisations, params)
 }
 
 // OrganisationsById queues the /organisations/:id endpoint and return a OrganisationStruct.
 func (a *client) OrganisationsById(id int, params Parameters) (OrganisationStruct, *ErrorStruct) {
-	sId := strconv.Itoa(id)
-	if params == nil {
-		params = make(Parameters)
+	return fetch[OrganisationStruct](a, "OrganisationsById", organisationsById+strconv.Itoa(id), params)
+}
+
+// requestError is the error get returns for error responses and requests the SDK
+// failed. It unwraps to the Err of the ErrorStruct, if any.
+type requestError struct {
+	err    *ErrorStruct
+	status int // The status of the error response, or 0 if the request failed.
+}
+
+func (e *requestError) Error() string {
+	if e.err.Err != nil {
+		return e.err.Err.Error()
+	}
+	return e.err.String()
+}
+
+// Unwrap returns the error within the SDK that failed the request, if any.
+func (e *requestError) Unwrap() error {
+	return e.err.Err
+}
+
+// errorStruct returns the ErrorStruct describing err, an error returned by get, or nil
+// if err is nil.
+func errorStruct(err error) *ErrorStruct {
+	if err == nil {
+		return nil
 	}
-	params.Set("access_token", a.oauth.AccessToken)
-	result := <-a.handler.addRequest(organisationsById+sId, params)
-
-	dec := json.NewDecoder(bytes.NewBuffer(result.body))
-	if 200 <= result.statuscode && result.statuscode < 300 {
-		target := OrganisationStruct{}
-		dec.Decode(&target)
-		return target, nil
-	} else {
-		target := ErrorStruct{}
-		dec.Decode(&target)
-		return OrganisationStruct{}, &target
+	var rerr *requestError
+	if errors.As(err, &rerr) {
+		return rerr.err
 	}
+	return errorFromResult(errorResult("when performing request", err))
+}
 
-	return OrganisationStruct{}, &ErrorStruct{}
+// errorFromResult returns the ErrorStruct describing a failed request.
+func errorFromResult(res result) *ErrorStruct {
+	target := ErrorStruct{}
+	json.Unmarshal(res.body, &target)
+	target.Err = res.err
+	return &target
 }
 
+// CreateSubscription registers the subscription on the push server and returns the ID
+// it was assigned. If an identical subscription already exists its ID is returned.
 func (a *client) CreateSubscription(sub Subscription) (uuid.UUID, error) {
-	params := make(Parameters)
-	params.Set("access_token", a.oauth.AccessToken)
+	return a.createSubscription(a.ctx, sub)
+}
 
-	u, err := url.Parse(subscriptions)
-	if err != nil {
-		return uuid.Nil, err
-	}
-	u.RawQuery = params.encode()
+// ListSubscriptions returns all subscriptions registered for the account.
+func (a *client) ListSubscriptions() ([]Subscription, error) {
+	return a.listSubscriptions(a.ctx)
+}
 
+// UpdateSubscription replaces the subscription with the given id and returns the
+// subscription as stored by the push server.
+func (a *client) UpdateSubscription(id uuid.UUID, sub Subscription) (Subscription, error) {
+	return a.updateSubscription(a.ctx, id, sub)
+}
+
+// DeleteSubscription removes the subscription with the given id.
+func (a *client) DeleteSubscription(id uuid.UUID) error {
+	return a.deleteSubscription(a.ctx, id)
+}
+
+func (a *client) createSubscription(ctx context.Context, sub Subscription) (uuid.UUID, error) {
 	subStr, err := json.Marshal(sub)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	res, err := http.Post(u.String(), "application/json", bytes.NewBuffer(subStr))
+
+	res, err := a.subscriptionRequest(ctx, "POST", subscriptions, subStr)
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	defer res.Body.Close()
-	dec := json.NewDecoder(res.Body)
 	if res.StatusCode == http.StatusOK {
 		s := &OnlyID{}
-		err = dec.Decode(s)
-		return s.ID, err
+		if err = json.Unmarshal(res.Body, s); err != nil {
+			return uuid.Nil, newDecodeError(a.handler.pipeline.urls.resolve(subscriptions), s, err)
+		}
+		return s.ID, nil
 	} else if res.StatusCode == http.StatusUnprocessableEntity {
 		if res.Header.Get("Location") != "" {
 			return uuid.FromString(res.Header.Get("Location"))
@@ -426,54 +220,52 @@ func (a *client) CreateSubscription(sub Subscription) (uuid.UUID, error) {
 	return uuid.Nil, fmt.Errorf("Unexpected status code %v", res.StatusCode)
 }
 
-func (a *client) ListSubscriptions() ([]Subscription, error) {
-	params := make(Parameters)
-	params.Set("access_token", a.oauth.AccessToken)
-
-	u, err := url.Parse(subscriptions)
-	if err != nil {
-		return nil, err
-	}
-	u.RawQuery = params.encode()
-	res, err := http.Get(u.String())
+func (a *client) listSubscriptions(ctx context.Context) ([]Subscription, error) {
+	res, err := a.subscriptionRequest(ctx, "GET", subscriptions, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
 
 	subs := []Subscription{}
 
-	dec := json.NewDecoder(res.Body)
 	if res.StatusCode == http.StatusOK {
-		dec.Decode(&subs)
+		if err := json.Unmarshal(res.Body, &subs); err != nil {
+			return []Subscription{}, newDecodeError(a.handler.pipeline.urls.resolve(subscriptions), &subs, err)
+		}
 		return subs, nil
 	}
 
 	return subs, fmt.Errorf("Unexpected status code %v", res.StatusCode)
 }
 
-func (a *client) DeleteSubscription(id uuid.UUID) error {
-	params := make(Parameters)
-	params.Set("access_token", a.oauth.AccessToken)
-
-	u, err := url.Parse(subscriptionsById + id.String())
+func (a *client) updateSubscription(ctx context.Context, id uuid.UUID, sub Subscription) (Subscription, error) {
+	sub.ID = id
+	subStr, err := json.Marshal(sub)
 	if err != nil {
-		return err
+		return Subscription{}, err
 	}
-	u.RawQuery = params.encode()
 
-	req, err := http.NewRequest("DELETE", u.String(), nil)
+	res, err := a.subscriptionRequest(ctx, "PUT", subscriptionsById+id.String(), subStr)
 	if err != nil {
-		return err
+		return Subscription{}, err
 	}
-	req.Header.Add("Content-Type", "application/json")
 
-	client := http.Client{}
-	res, err := client.Do(req)
+	if res.StatusCode == http.StatusOK {
+		updated := Subscription{}
+		if err = json.Unmarshal(res.Body, &updated); err != nil {
+			return Subscription{}, newDecodeError(a.handler.pipeline.urls.resolve(subscriptionsById+id.String()), &updated, err)
+		}
+		return updated, nil
+	}
+
+	return Subscription{}, fmt.Errorf("Unexpected status code %v", res.StatusCode)
+}
+
+func (a *client) deleteSubscription(ctx context.Context, id uuid.UUID) error {
+	res, err := a.subscriptionRequest(ctx, "DELETE", subscriptionsById+id.String(), nil)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
 
 	if res.StatusCode == http.StatusOK {
 		return nil
@@ -481,3 +273,103 @@ func (a *client) DeleteSubscription(id uuid.UUID) error {
 
 	return fmt.Errorf("Unexpected status code %v", res.StatusCode)
 }
+
+// subscriptionRequest performs a request against the subscription endpoints of the
+// push API with the current access token added. The request is sent through the
+// middleware chain but not the request queue.
+func (a *client) subscriptionRequest(ctx context.Context, method, target string, body []byte) (*Response, error) {
+	params := make(Parameters)
+	params.Set("access_token", a.oauth.get().AccessToken)
+
+	ctx, span := startHTTP(a.handler.getTracer(), ctx, method, target)
+	defer endSpan(span)
+
+	req, err := a.handler.pipeline.newRequest(ctx, method, target, params, body)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	req.HTTP.Header.Set("Content-Type", "application/json")
+
+	res, err := a.handler.pipeline.do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(Attributes{"http.status_code": res.StatusCode})
+	return res, nil
+}
+
+// EnsureSubscription makes sure a subscription with the same Name as desired is
+// registered on the push server with the filters of desired. An existing subscription
+// is updated if its filters or description differ and a new one is created if none
+// exists. If several subscriptions have the name, e.g. because a create was retried,
+// one is kept, preferably one that is up to date, and the others are deleted. The
+// returned Subscription carries the ID to connect with.
+func (a *client) EnsureSubscription(ctx context.Context, desired Subscription) (Subscription, error) {
+	if desired.Name == "" {
+		return Subscription{}, fmt.Errorf("EnsureSubscription requires the subscription to have a name")
+	}
+
+	subs, err := a.listSubscriptions(ctx)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	existing, duplicates, found := subscription.Pick(subs, desired)
+	for _, dup := range duplicates {
+		if err := a.deleteSubscription(ctx, dup.ID); err != nil {
+			return Subscription{}, err
+		}
+	}
+
+	if found {
+		if subscription.UpToDate(existing, desired) {
+			return existing, nil
+		}
+
+		updated, err := a.updateSubscription(ctx, existing.ID, desired)
+		if err != nil {
+			return Subscription{}, err
+		}
+		if updated.ID == uuid.Nil {
+			updated.ID = existing.ID
+		}
+		return updated, nil
+	}
+
+	id, err := a.createSubscription(ctx, desired)
+	if err != nil {
+		return Subscription{}, err
+	}
+	desired.ID = id
+	return desired, nil
+}
+
+// PruneSubscriptions deletes every registered subscription for which keep returns
+// false, e.g. subscriptions left behind by older deployments. The deleted subscriptions
+// are returned. Pruning stops at the first failed deletion. keep must not be nil.
+func (a *client) PruneSubscriptions(keep func(Subscription) bool) ([]Subscription, error) {
+	if keep == nil {
+		return nil, fmt.Errorf("PruneSubscriptions requires a keep function")
+	}
+
+	ctx := a.ctx
+	subs, err := a.listSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []Subscription{}
+	for _, sub := range subs {
+		if keep(sub) {
+			continue
+		}
+		if err := a.deleteSubscription(ctx, sub.ID); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, sub)
+	}
+
+	return pruned, nil
+}
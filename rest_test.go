@@ -0,0 +1,105 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// newTestClient returns a client authenticating any credentials against a test server
+// that sends every other request to api.
+func newTestClient(t *testing.T, api http.Handler) *client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"token","token_type":"bearer","expires_in":3600}`))
+	})
+	if api != nil {
+		mux.Handle("/", api)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return New("id", "secret", WithBaseURL(server.URL+"/v2/"), WithRate(1000, 60000))
+}
+
+// response is a canned response of a test server.
+type response struct {
+	status int
+	body   string
+}
+
+// respond returns a handler answering the paths in responses, and 404 otherwise.
+func respond(responses map[string]response) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := responses[r.URL.Path]
+		if !ok {
+			res = response{404, `{"error":"Not Found","error_code":404}`}
+		}
+		w.WriteHeader(res.status)
+		w.Write([]byte(res.body))
+	})
+}
+
+func TestGet(t *testing.T) {
+	a := newTestClient(t, respond(map[string]response{
+		"/v2/series/1": {200, `{"id":1,"title":"Final"}`},
+		"/v2/series/2": {200, `{"id":"two"}`},
+		"/v2/series/3": {404, `{"error":"Not Found","error_code":404,"error_description":"No series with id 3"}`},
+	}))
+
+	tests := []struct {
+		name     string
+		endpoint string
+		wantCode int64 // ErrorCode of the ErrorStruct, if the request fails.
+		wantErr  error // What the error unwraps to, if anything.
+		decode   bool  // Whether the error is a DecodeError.
+	}{
+		{name: "ok", endpoint: seriesById + "1"},
+		{name: "decode error", endpoint: seriesById + "2", decode: true},
+		{name: "error response", endpoint: seriesById + "3", wantCode: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := get[SeriesStruct](context.Background(), a, tt.endpoint, nil)
+			if !tt.decode && tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if s.Id != 1 || s.Title != "Final" {
+					t.Fatalf("got %+v", s)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			var derr *DecodeError
+			if errors.As(err, &derr) != tt.decode {
+				t.Errorf("errors.As(%v, *DecodeError) = %v, want %v", err, !tt.decode, tt.decode)
+			}
+			if code := errorStruct(err).ErrorCode; code != tt.wantCode {
+				t.Errorf("ErrorCode = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestGetCancelled(t *testing.T) {
+	a := newTestClient(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := get[SeriesStruct](ctx, a, seriesById+"1", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if e := errorStruct(err); e == nil || !errors.Is(e.Err, context.Canceled) {
+		t.Fatalf("errorStruct(%v) = %v", err, e)
+	}
+}
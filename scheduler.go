@@ -0,0 +1,307 @@
+package abios
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// RefreshPriority ranks how urgently a tracked series needs to be refreshed. Lower
+// values are more urgent.
+type RefreshPriority int
+
+const (
+	RefreshDeciding RefreshPriority = iota // Live and a roster is one map away from winning.
+	RefreshLive                            // Started but not ended.
+	RefreshSoon                            // Starts within the hour.
+	RefreshToday                           // Starts within a day.
+	RefreshLater                           // Starts later or hasn't been scheduled.
+	RefreshOver                            // Ended or deleted, no longer refreshed.
+)
+
+// String returns the name of the priority.
+func (p RefreshPriority) String() string {
+	switch p {
+	case RefreshDeciding:
+		return "deciding"
+	case RefreshLive:
+		return "live"
+	case RefreshSoon:
+		return "soon"
+	case RefreshToday:
+		return "today"
+	case RefreshLater:
+		return "later"
+	default:
+		return "over"
+	}
+}
+
+// refreshPriority returns the priority of s at the given time.
+func refreshPriority(s SeriesStruct, now time.Time) RefreshPriority {
+	switch phaseOf(s, now) {
+	case phaseLive:
+		if s.Scores != nil && s.BestOf > 1 {
+			for _, score := range *s.Scores {
+				if score == s.BestOf/2 {
+					return RefreshDeciding
+				}
+			}
+		}
+		return RefreshLive
+	case phaseSoon:
+		return RefreshSoon
+	case phaseToday:
+		return RefreshToday
+	case phaseLater:
+		return RefreshLater
+	default:
+		return RefreshOver
+	}
+}
+
+// PlannedRefresh describes when a tracked series is refreshed next.
+type PlannedRefresh struct {
+	SeriesId int64
+	Priority RefreshPriority
+	Interval time.Duration // The interval granted within the budget.
+	Next     time.Time
+}
+
+// scheduled is a series tracked by the Scheduler.
+type scheduled struct {
+	series   SeriesStruct
+	priority RefreshPriority
+	interval time.Duration
+	next     time.Time
+}
+
+// Scheduler refreshes a set of tracked series through SeriesById. Each series is given
+// a RefreshPriority from its start and end times and its score, and the requests per
+// minute are split so that live series are refreshed often while series far in the
+// future use little of the budget.
+type Scheduler struct {
+	sdk       AbiosSdk
+	budget    int            // Requests per minute the scheduler may use.
+	intervals WatchIntervals // The intervals we'd like if the budget allows it.
+
+	mu      sync.Mutex
+	tracked map[int64]*scheduled
+	wake    chan struct{}
+}
+
+// NewScheduler returns a Scheduler that uses at most budget requests per minute. A
+// budget less than or equal to 0 means the per minute rate of sdk (see SetRate), or the
+// default rate if sdk doesn't report one. Zero intervals are replaced by
+// DefaultWatchIntervals.
+func NewScheduler(sdk AbiosSdk, budget int, intervals WatchIntervals) *Scheduler {
+	if budget <= 0 {
+		budget = default_requests_per_minute
+		if r, ok := sdk.(interface{ Rate() (second, minute int) }); ok {
+			_, budget = r.Rate()
+		}
+	}
+	return &Scheduler{
+		sdk:       sdk,
+		budget:    budget,
+		intervals: intervals.withDefaults(),
+		tracked:   make(map[int64]*scheduled),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Track adds series to the schedule. They are refreshed as soon as possible to learn
+// their priority.
+func (s *Scheduler) Track(ids ...int64) {
+	s.mu.Lock()
+	for _, id := range ids {
+		if _, ok := s.tracked[id]; !ok {
+			s.tracked[id] = &scheduled{priority: RefreshDeciding}
+		}
+	}
+	s.plan(time.Now())
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Untrack removes series from the schedule.
+func (s *Scheduler) Untrack(ids ...int64) {
+	s.mu.Lock()
+	for _, id := range ids {
+		delete(s.tracked, id)
+	}
+	s.plan(time.Now())
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Schedule returns the planned refreshes ordered by when they happen.
+func (s *Scheduler) Schedule() []PlannedRefresh {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	planned := make([]PlannedRefresh, 0, len(s.tracked))
+	for id, t := range s.tracked {
+		planned = append(planned, PlannedRefresh{
+			SeriesId: id,
+			Priority: t.priority,
+			Interval: t.interval,
+			Next:     t.next,
+		})
+	}
+	sort.Slice(planned, func(i, j int) bool {
+		return planned[i].Next.Before(planned[j].Next)
+	})
+	return planned
+}
+
+// Run refreshes tracked series as they become due until ctx is done. onUpdate is called
+// with every refreshed series and onError with every failed refresh. Series that are
+// over are refreshed a final time and then untracked.
+func (s *Scheduler) Run(ctx context.Context, onUpdate func(SeriesStruct), onError func(int64, *ErrorStruct)) {
+	for {
+		id, due, ok := s.nextDue()
+		if !ok {
+			due = time.Now().Add(time.Minute)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+			continue // The schedule changed.
+		case <-time.After(time.Until(due)):
+		}
+
+		if !ok {
+			continue
+		}
+
+		series, err := s.sdk.WithContext(WithPriority(ctx, s.lane(id))).SeriesById(int(id), nil)
+		now := time.Now()
+
+		s.mu.Lock()
+		t, tracked := s.tracked[id]
+		if tracked {
+			if err == nil {
+				t.series = series
+				t.priority = refreshPriority(series, now)
+			}
+			t.next = now.Add(t.interval)
+			if t.priority == RefreshOver {
+				delete(s.tracked, id)
+			}
+			s.plan(now)
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			if onError != nil {
+				onError(id, err)
+			}
+		} else if onUpdate != nil {
+			onUpdate(series)
+		}
+	}
+}
+
+// lane returns the queue priority the refresh of a tracked series is performed with.
+func (s *Scheduler) lane(id int64) Priority {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tracked[id]; ok && t.priority > RefreshLive {
+		return PriorityBackground
+	}
+	return PriorityLive
+}
+
+// nextDue returns the tracked series that is due first.
+func (s *Scheduler) nextDue() (int64, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id int64
+	var due time.Time
+	found := false
+	for i, t := range s.tracked {
+		if !found || t.next.Before(due) {
+			id, due, found = i, t.next, true
+		}
+	}
+	return id, due, found
+}
+
+// notify wakes up Run so it picks up changes to the schedule.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// desired returns the interval we'd like for a priority if the budget were unlimited.
+func (s *Scheduler) desired(p RefreshPriority) time.Duration {
+	switch p {
+	case RefreshDeciding:
+		return s.intervals.Live / 2
+	case RefreshLive:
+		return s.intervals.Live
+	case RefreshSoon:
+		return s.intervals.Soon
+	case RefreshToday:
+		return s.intervals.Today
+	default:
+		return s.intervals.Later
+	}
+}
+
+// plan splits the budget between the tracked series. Every priority with tracked series
+// is first reserved one request per minute so nothing is starved completely. The rest
+// is handed out in priority order: a priority whose desired intervals fit in what is
+// left gets them, otherwise its series share what is left evenly. Must be called with
+// s.mu held.
+func (s *Scheduler) plan(now time.Time) {
+	byPriority := make(map[RefreshPriority][]*scheduled)
+	for _, t := range s.tracked {
+		byPriority[t.priority] = append(byPriority[t.priority], t)
+	}
+
+	remaining := float64(s.budget - len(byPriority))
+	for p := RefreshDeciding; p <= RefreshOver; p++ {
+		entries := byPriority[p]
+		if len(entries) == 0 {
+			continue
+		}
+		remaining += 1 // This priority's reserved request.
+
+		n := float64(len(entries))
+		interval := s.desired(p)
+		demand := n * float64(time.Minute) / float64(interval) // Requests per minute.
+		if remaining < demand {
+			granted := remaining
+			if granted < 1 {
+				granted = 1
+			}
+			interval = time.Duration(n * float64(time.Minute) / granted)
+			demand = granted
+		}
+		remaining -= demand
+
+		for _, t := range entries {
+			if t.interval != interval {
+				// Keep the last refresh as the reference point when the interval changes.
+				if !t.next.IsZero() {
+					t.next = t.next.Add(interval - t.interval)
+				}
+				t.interval = interval
+			}
+			if t.next.IsZero() {
+				t.next = now
+			}
+		}
+	}
+}
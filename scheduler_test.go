@@ -0,0 +1,83 @@
+package abios
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+func TestRefreshPriority(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *string {
+		s := now.Add(d).Format(timeLayout)
+		return &s
+	}
+	ended := "2024-01-01T11:00:00Z"
+	tests := []struct {
+		name   string
+		series SeriesStruct
+		want   RefreshPriority
+	}{
+		{"deciding", SeriesStruct{Start: at(-time.Hour), BestOf: 3, Scores: &ScoresStruct{"1": 1, "2": 0}}, RefreshDeciding},
+		{"live", SeriesStruct{Start: at(-time.Hour), BestOf: 3, Scores: &ScoresStruct{"1": 0, "2": 0}}, RefreshLive},
+		{"live best of one", SeriesStruct{Start: at(-time.Hour), BestOf: 1, Scores: &ScoresStruct{"1": 0, "2": 0}}, RefreshLive},
+		{"soon", SeriesStruct{Start: at(30 * time.Minute)}, RefreshSoon},
+		{"today", SeriesStruct{Start: at(5 * time.Hour)}, RefreshToday},
+		{"later", SeriesStruct{Start: at(48 * time.Hour)}, RefreshLater},
+		{"unscheduled", SeriesStruct{}, RefreshLater},
+		{"ended", SeriesStruct{Start: at(-time.Hour), End: &ended}, RefreshOver},
+		{"deleted", SeriesStruct{Start: at(time.Hour), DeletedAt: &ended}, RefreshOver},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refreshPriority(tt.series, now); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerPlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget int
+		live   int // Tracked live series.
+		later  int // Tracked series starting later.
+		want   map[RefreshPriority]time.Duration
+	}{
+		{"everything fits", 60, 2, 1, map[RefreshPriority]time.Duration{
+			RefreshLive:  DefaultWatchIntervals.Live,
+			RefreshLater: DefaultWatchIntervals.Later,
+		}},
+		{"live shares what's left", 10, 4, 1, map[RefreshPriority]time.Duration{
+			RefreshLive:  4 * time.Minute / 9,
+			RefreshLater: DefaultWatchIntervals.Later,
+		}},
+		{"reserved request only", 2, 4, 1, map[RefreshPriority]time.Duration{
+			RefreshLive:  4 * time.Minute,
+			RefreshLater: DefaultWatchIntervals.Later,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(nil, tt.budget, WatchIntervals{})
+			var id int64
+			for p, n := range map[RefreshPriority]int{RefreshLive: tt.live, RefreshLater: tt.later} {
+				for i := 0; i < n; i++ {
+					id++
+					s.tracked[id] = &scheduled{priority: p}
+				}
+			}
+			s.plan(time.Now())
+
+			for _, r := range s.Schedule() {
+				if r.Interval != tt.want[r.Priority] {
+					t.Errorf("%v series %d: got interval %v, want %v", r.Priority, r.SeriesId, r.Interval, tt.want[r.Priority])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package abios
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/uuid"
+)
+
+// Grant records that a replica sent a request.
+type Grant struct {
+	Replica string    `json:"replica"`
+	At      time.Time `json:"at"`
+}
+
+// LimiterStore holds the grants of a SharedLimiter where all replicas can see them.
+// Implementations could be backed by e.g. a file, Redis or a database.
+type LimiterStore interface {
+	// Update atomically reads the stored grants, passes them to fn and stores what fn
+	// returns. No other Update may interleave with it, in this or any other process.
+	Update(ctx context.Context, fn func(grants []Grant) []Grant) error
+}
+
+// SharedLimiter is a Limiter that coordinates replicas, possibly in different
+// processes, through a LimiterStore so that together they send at most second requests
+// per second and minute requests per minute. Replicas that sent requests during the
+// last minute get an equal share of the rate each, so a busy replica can't starve the
+// others. A replica that is alone gets the whole rate.
+type SharedLimiter struct {
+	store   LimiterStore
+	replica string
+
+	mu     sync.Mutex
+	second int
+	minute int
+}
+
+// Time between two attempts when the store gives no better estimate.
+const shared_limiter_poll_interval = 50 * time.Millisecond
+
+// NewSharedLimiter returns a SharedLimiter storing its grants in store. Every
+// SharedLimiter is a replica of its own.
+func NewSharedLimiter(store LimiterStore, second, minute int) *SharedLimiter {
+	l := &SharedLimiter{
+		store:   store,
+		replica: uuid.Must(uuid.NewV4()).String(),
+		second:  default_requests_per_second,
+		minute:  default_requests_per_minute,
+	}
+	l.SetRate(second, minute)
+	return l
+}
+
+// SetRate sets the rate shared by all replicas. A value less than or equal to 0 means
+// the previous value is kept. Every replica should be given the same rate.
+func (l *SharedLimiter) SetRate(second, minute int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if 0 < second {
+		l.second = second
+	}
+
+	if 0 < minute {
+		l.minute = minute
+	}
+
+	// Make sure they are consistent
+	if l.second > l.minute {
+		l.second = l.minute
+	}
+}
+
+// Rate returns the rate shared by all replicas.
+func (l *SharedLimiter) Rate() (second, minute int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.second, l.minute
+}
+
+// Wait blocks until this replica may send a request.
+func (l *SharedLimiter) Wait(ctx context.Context) error {
+	for {
+		second, minute := l.Rate()
+
+		var wait time.Duration
+		err := l.store.Update(ctx, func(grants []Grant) []Grant {
+			var kept []Grant
+			kept, wait = l.reserve(grants, time.Now(), second, minute)
+			return kept
+		})
+		if err != nil {
+			return err
+		}
+		if wait == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve drops grants older than a minute and adds a grant for this replica if that
+// keeps both the total and this replica's share within the rate. It returns the grants
+// to store and 0, or how long to wait before trying again if no grant was added.
+func (l *SharedLimiter) reserve(grants []Grant, now time.Time, second, minute int) ([]Grant, time.Duration) {
+	kept := grants[:0]
+	replicas := map[string]bool{l.replica: true}
+	var lastSecond, lastMinute, own, ownLastSecond []time.Time
+
+	for _, g := range grants {
+		age := now.Sub(g.At)
+		if age >= time.Minute {
+			continue
+		}
+		kept = append(kept, g)
+		replicas[g.Replica] = true
+		lastMinute = append(lastMinute, g.At)
+		if age < time.Second {
+			lastSecond = append(lastSecond, g.At)
+		}
+		if g.Replica == l.replica {
+			own = append(own, g.At)
+			if age < time.Second {
+				ownLastSecond = append(ownLastSecond, g.At)
+			}
+		}
+	}
+
+	n := float64(len(replicas))
+	shareSecond := int(math.Ceil(float64(second) / n))
+	shareMinute := int(math.Ceil(float64(minute) / n))
+
+	var wait time.Duration
+	wait = maxDuration(wait, untilFree(lastSecond, second, time.Second, now))
+	wait = maxDuration(wait, untilFree(lastMinute, minute, time.Minute, now))
+	wait = maxDuration(wait, untilFree(ownLastSecond, shareSecond, time.Second, now))
+	wait = maxDuration(wait, untilFree(own, shareMinute, time.Minute, now))
+
+	if wait == 0 {
+		kept = append(kept, Grant{Replica: l.replica, At: now})
+	}
+	return kept, wait
+}
+
+// untilFree returns how long until fewer than limit of the given times are within the
+// window, or 0 if that is already the case.
+func untilFree(times []time.Time, limit int, window time.Duration, now time.Time) time.Duration {
+	if len(times) < limit {
+		return 0
+	}
+	if limit <= 0 {
+		return shared_limiter_poll_interval
+	}
+
+	// Times are not necessarily sorted since replicas write them concurrently.
+	oldest := make([]time.Time, len(times))
+	copy(oldest, times)
+	sort.Slice(oldest, func(i, j int) bool { return oldest[i].Before(oldest[j]) })
+
+	wait := oldest[len(oldest)-limit].Add(window).Sub(now)
+	if wait <= 0 {
+		return shared_limiter_poll_interval
+	}
+	return wait
+}
+
+// maxDuration returns the larger of a and b.
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// FileStore is a LimiterStore keeping the grants as JSON in a local file. Access is
+// serialized with a file lock, which makes it suitable for replicas running on the
+// same machine or sharing a file system that supports locking.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a FileStore using the file at path, which is created if needed.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Update locks the file, applies fn to the grants in it and writes the result back.
+func (s *FileStore) Update(ctx context.Context, fn func(grants []Grant) []Grant) error {
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := lockFile(ctx, f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	grants := []Grant{}
+	if len(data) > 0 {
+		// A corrupt file is treated as empty rather than blocking every replica.
+		json.Unmarshal(data, &grants)
+	}
+
+	data, err = json.Marshal(fn(grants))
+	if err != nil {
+		return err
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return nil
+}
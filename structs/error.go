@@ -4,11 +4,13 @@ import (
 	"fmt"
 )
 
-// ErrorStruct represents an error response from the API.
+// ErrorStruct represents an error response from the API. Errors that happen within the
+// SDK are represented the same way with ErrorCode 0 and the error itself in Err.
 type ErrorStruct struct {
 	Error            string `json:"error,omitempty"`
 	ErrorCode        int64  `json:"error_code,omitempty"`
 	ErrorDescription string `json:"error_description,omitempty"`
+	Err              error  `json:"-"` // The application error, if any.
 }
 
 func (e ErrorStruct) String() (s string) {
@@ -0,0 +1,65 @@
+package structs
+
+// Matches reports whether the push server would deliver m to a subscriber of s. A
+// message matches the subscription if it matches at least one of its filters, and a
+// filter matches if every field it sets agrees with the message. Messages on the
+// 'system' channel are never filtered.
+func (s Subscription) Matches(m PushMessage) bool {
+	if m.Channel == "system" {
+		return true
+	}
+
+	for _, f := range s.Filters {
+		if f.Matches(m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches reports whether every field set on the filter agrees with m.
+func (f SubscriptionFilter) Matches(m PushMessage) bool {
+	if f.Channel != "" && f.Channel != m.Channel {
+		return false
+	}
+
+	state, _ := m.Payload["state"].(map[string]interface{})
+
+	if f.SeriesID != 0 && jsonInt(state["id"]) != int64(f.SeriesID) {
+		return false
+	}
+
+	if f.GameID != 0 {
+		game, _ := state["game"].(map[string]interface{})
+		if jsonInt(game["id"]) != int64(f.GameID) {
+			return false
+		}
+	}
+
+	if f.MatchID != 0 {
+		matches, _ := state["matches"].([]interface{})
+		found := false
+		for _, match := range matches {
+			match, _ := match.(map[string]interface{})
+			if jsonInt(match["id"]) == int64(f.MatchID) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// jsonInt converts a number decoded by encoding/json into an int64. Anything else is
+// returned as 0.
+func jsonInt(v interface{}) int64 {
+	if n, ok := v.(float64); ok {
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package structs
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// message decodes a push message the way it arrives from the push server.
+func message(t *testing.T, raw string) PushMessage {
+	t.Helper()
+	var m PushMessage
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+const seriesUpdate = `{
+	"channel": "series",
+	"payload": {"state": {"id": 10, "game": {"id": 2}, "matches": [{"id": 100}, {"id": 101}]}}
+}`
+
+func TestSubscriptionFilterMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter SubscriptionFilter
+		raw    string
+		want   bool
+	}{
+		{"empty filter", SubscriptionFilter{}, seriesUpdate, true},
+		{"channel", SubscriptionFilter{Channel: "series"}, seriesUpdate, true},
+		{"other channel", SubscriptionFilter{Channel: "match"}, seriesUpdate, false},
+		{"game", SubscriptionFilter{GameID: 2}, seriesUpdate, true},
+		{"other game", SubscriptionFilter{GameID: 3}, seriesUpdate, false},
+		{"series", SubscriptionFilter{SeriesID: 10}, seriesUpdate, true},
+		{"other series", SubscriptionFilter{SeriesID: 11}, seriesUpdate, false},
+		{"match", SubscriptionFilter{MatchID: 101}, seriesUpdate, true},
+		{"other match", SubscriptionFilter{MatchID: 102}, seriesUpdate, false},
+		{"every field", SubscriptionFilter{Channel: "series", GameID: 2, SeriesID: 10, MatchID: 100}, seriesUpdate, true},
+		{"one field differs", SubscriptionFilter{Channel: "series", GameID: 2, SeriesID: 11}, seriesUpdate, false},
+		{"no state", SubscriptionFilter{SeriesID: 10}, `{"channel": "series", "payload": {}}`, false},
+		{"no matches", SubscriptionFilter{MatchID: 100}, `{"channel": "series", "payload": {"state": {"id": 10}}}`, false},
+		{"id isn't a number", SubscriptionFilter{SeriesID: 10}, `{"channel": "series", "payload": {"state": {"id": "10"}}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(message(t, tt.raw)); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	system := `{"channel": "system", "payload": {"type": "reconnect"}}`
+
+	tests := []struct {
+		name    string
+		filters []SubscriptionFilter
+		raw     string
+		want    bool
+	}{
+		{"no filters", nil, seriesUpdate, false},
+		{"no filters, system message", nil, system, true},
+		{"system message", []SubscriptionFilter{{Channel: "series", GameID: 3}}, system, true},
+		{"one filter matches", []SubscriptionFilter{{GameID: 3}, {SeriesID: 10}}, seriesUpdate, true},
+		{"no filter matches", []SubscriptionFilter{{GameID: 3}, {SeriesID: 11}}, seriesUpdate, false},
+		{"channel only", []SubscriptionFilter{{Channel: "series"}}, seriesUpdate, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Subscription{Name: "test", Filters: tt.filters}
+			if got := s.Matches(message(t, tt.raw)); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package abios_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	abios "github.com/PatronGG/abios-go-sdk"
+	"github.com/PatronGG/abios-go-sdk/abiostest"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+)
+
+// methods returns the methods of calls, in order.
+func methods(calls []abiostest.Call) []string {
+	var m []string
+	for _, c := range calls {
+		m = append(m, c.Method)
+	}
+	return m
+}
+
+func TestEnsureSubscription(t *testing.T) {
+	existing := Subscription{
+		Name:        "scores",
+		Description: "live scores",
+		Filters:     []SubscriptionFilter{{Channel: "series", GameID: 1}, {Channel: "series", GameID: 2}},
+	}
+
+	tests := []struct {
+		name    string
+		desired Subscription
+		want    []string // Methods called after listing the subscriptions.
+		sameID  bool     // Whether the existing subscription is returned.
+	}{
+		{"create", Subscription{Name: "odds", Filters: []SubscriptionFilter{{Channel: "series"}}}, []string{"CreateSubscription"}, false},
+		{"no-op", existing, nil, true},
+		{"filters in another order", Subscription{
+			Name:        "scores",
+			Description: "live scores",
+			Filters:     []SubscriptionFilter{{Channel: "series", GameID: 2}, {Channel: "series", GameID: 1}},
+		}, nil, true},
+		{"filters differ", Subscription{
+			Name:        "scores",
+			Description: "live scores",
+			Filters:     []SubscriptionFilter{{Channel: "series", GameID: 1}},
+		}, []string{"UpdateSubscription"}, true},
+		{"description differs", Subscription{
+			Name:        "scores",
+			Description: "all scores",
+			Filters:     existing.Filters,
+		}, []string{"UpdateSubscription"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := abiostest.NewServer()
+			defer server.Close()
+			a := abios.New("id", "secret", server.Options()...)
+
+			id, err := a.CreateSubscription(existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := len(server.Fake.Calls())
+
+			got, err := a.EnsureSubscription(context.Background(), tt.desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls := methods(server.Fake.Calls()[before:])
+			if len(calls) == 0 || calls[0] != "ListSubscriptions" {
+				t.Fatalf("got calls %v, want the subscriptions listed first", calls)
+			}
+			if calls := calls[1:]; len(calls) != len(tt.want) || len(calls) == 1 && calls[0] != tt.want[0] {
+				t.Fatalf("got calls %v, want %v", calls, tt.want)
+			}
+			if (got.ID == id) != tt.sameID || got.ID == uuid.Nil {
+				t.Errorf("got id %v, existing subscription has %v", got.ID, id)
+			}
+			if got.Name != tt.desired.Name || got.Description != tt.desired.Description {
+				t.Errorf("got %+v, want %+v", got, tt.desired)
+			}
+
+			subs, err := a.ListSubscriptions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sub := range subs {
+				if sub.ID == got.ID && sub.Description != tt.desired.Description {
+					t.Errorf("stored description %q, want %q", sub.Description, tt.desired.Description)
+				}
+			}
+		})
+	}
+}
+
+func TestEnsureSubscriptionDuplicates(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+
+	desired := Subscription{Name: "scores", Filters: []SubscriptionFilter{{Channel: "series", GameID: 1}}}
+	older := Subscription{Name: "scores", Filters: []SubscriptionFilter{{Channel: "series"}}}
+	retried := Subscription{Name: "scores", Filters: []SubscriptionFilter{{Channel: "series", GameID: 2}}}
+	var ids []uuid.UUID
+	for _, sub := range []Subscription{older, desired, retried} {
+		id, err := a.CreateSubscription(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	before := len(server.Fake.Calls())
+
+	got, err := a.EnsureSubscription(context.Background(), desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != ids[1] {
+		t.Errorf("got id %v, want the up to date subscription %v", got.ID, ids[1])
+	}
+	calls := methods(server.Fake.Calls()[before:])
+	if want := []string{"ListSubscriptions", "DeleteSubscription", "DeleteSubscription"}; strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("got calls %v, want %v", calls, want)
+	}
+
+	subs, err := a.ListSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].ID != ids[1] {
+		t.Fatalf("got %v left, want only %v", subs, ids[1])
+	}
+}
+
+func TestEnsureSubscriptionWithoutName(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+
+	if _, err := a.EnsureSubscription(context.Background(), Subscription{}); err == nil {
+		t.Fatal("a subscription without a name is accepted")
+	}
+}
+
+func TestSubscriptionCallsUseContext(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	view := a.WithContext(ctx)
+
+	if _, err := view.CreateSubscription(Subscription{Name: "scores"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateSubscription: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := view.ListSubscriptions(); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListSubscriptions: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := view.PruneSubscriptions(func(Subscription) bool { return false }); !errors.Is(err, context.Canceled) {
+		t.Errorf("PruneSubscriptions: got %v, want %v", err, context.Canceled)
+	}
+	if len(server.Fake.Calls()) != 0 {
+		t.Errorf("got calls %v after cancelling", methods(server.Fake.Calls()))
+	}
+}
+
+func TestPruneSubscriptionsWithoutKeep(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+
+	if _, err := a.PruneSubscriptions(nil); err == nil {
+		t.Fatal("a nil keep function is accepted")
+	}
+}
+
+func TestPruneSubscriptions(t *testing.T) {
+	server := abiostest.NewServer()
+	defer server.Close()
+	a := abios.New("id", "secret", server.Options()...)
+
+	for _, name := range []string{"old-1", "current", "old-2", "old-3"} {
+		if _, err := a.CreateSubscription(Subscription{Name: name, Filters: []SubscriptionFilter{{Channel: "series"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subs, err := a.ListSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep := func(s Subscription) bool { return s.Name == "current" }
+
+	// The second deletion fails, so only the first of the old subscriptions is pruned.
+	var old []Subscription
+	for _, s := range subs {
+		if !keep(s) {
+			old = append(old, s)
+		}
+	}
+	server.Fake.FailNext("DeleteSubscription", nil)
+	server.Fake.FailNext("DeleteSubscription", abiostest.NotFound("gone"))
+
+	pruned, err := a.PruneSubscriptions(keep)
+	if err == nil {
+		t.Fatal("the failed deletion isn't returned")
+	}
+	if len(pruned) != 1 || pruned[0].ID != old[0].ID {
+		t.Fatalf("pruned %v, want only %v", pruned, old[0].ID)
+	}
+
+	left, err := a.ListSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != len(subs)-1 {
+		t.Fatalf("%d subscriptions left, want %d", len(left), len(subs)-1)
+	}
+
+	pruned, err = a.PruneSubscriptions(keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != len(old)-1 {
+		t.Fatalf("pruned %d subscriptions, want %d", len(pruned), len(old)-1)
+	}
+	left, err = a.ListSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].Name != "current" {
+		t.Fatalf("got %v left, want only the current subscription", left)
+	}
+}
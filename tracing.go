@@ -0,0 +1,143 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/PatronGG/abios-go-sdk/internal/route"
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+// Attributes describe a span, e.g. the endpoint or the ID of the entity requested.
+type Attributes map[string]interface{}
+
+// Tracer creates spans for SDK calls and the steps they go through. It is small enough
+// for an adapter to e.g. OpenTelemetry to satisfy: start and end times are given
+// explicitly since the queue and rate-limit waits are only known once they are over.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span called name, as a child of the span in ctx if there is one,
+	// and returns a context carrying the new span.
+	Start(ctx context.Context, name string, start time.Time, attrs Attributes) (context.Context, Span)
+}
+
+// Span is a traced operation.
+type Span interface {
+	SetAttributes(attrs Attributes)
+	RecordError(err error)
+	End(end time.Time)
+}
+
+// nopTracer creates spans that do nothing. It is used until SetTracer is called.
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string, start time.Time, attrs Attributes) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs Attributes) {}
+func (nopSpan) RecordError(err error)          {}
+func (nopSpan) End(end time.Time)              {}
+
+// Names of the spans created by the SDK. SDK calls are named "abios." followed by the
+// method, e.g. "abios.SeriesById".
+const (
+	spanQueueWait     = "abios.queue_wait"
+	spanRateLimitWait = "abios.rate_limit_wait"
+	spanHTTP          = "abios.http"
+	spanDecode        = "abios.decode"
+)
+
+// SetTracer sets the Tracer SDK calls are traced with. The trace context is taken from
+// the context given to WithContext. nil disables tracing, which is the default.
+func (a *client) SetTracer(t Tracer) {
+	if t == nil {
+		t = nopTracer{}
+	}
+	a.handler.hooksMu.Lock()
+	defer a.handler.hooksMu.Unlock()
+	a.handler.tracer = t
+}
+
+// callKey is the context key the name of the SDK call is stored under.
+type callKey struct{}
+
+// withCall returns a copy of ctx naming the SDK call the requests made with it belong
+// to, e.g. "SeriesById".
+func withCall(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, callKey{}, method)
+}
+
+// startCall starts the span of the SDK call requesting endpoint with params. The span
+// is named after the call stored in ctx by withCall, or the endpoint if there is none.
+func (a *client) startCall(ctx context.Context, endpoint string, params Parameters) (context.Context, Span) {
+	family := route.Family(endpoint)
+	method, ok := ctx.Value(callKey{}).(string)
+	if !ok {
+		method = family
+	}
+
+	attrs := Attributes{"abios.endpoint": family}
+	if id, err := strconv.Atoi(path.Base(endpoint)); err == nil {
+		attrs["abios.id"] = id
+	}
+	if page := params["page"]; len(page) > 0 {
+		attrs["abios.page"] = page[0]
+	}
+	return a.handler.getTracer().Start(ctx, "abios."+method, time.Now(), attrs)
+}
+
+// endSpan ends span now. It is meant to be deferred.
+func endSpan(span Span) {
+	span.End(time.Now())
+}
+
+// callError records the failed result on the span of the SDK call and returns the
+// ErrorStruct describing it.
+func callError(span Span, res result) *ErrorStruct {
+	err := errorFromResult(res)
+	span.SetAttributes(Attributes{"http.status_code": res.statuscode})
+	if err.Err != nil {
+		span.RecordError(err.Err)
+	} else {
+		span.RecordError(errors.New(err.String()))
+	}
+	return err
+}
+
+// traceWaits records the time req spent in the queue, and the part of it the dispatcher
+// spent waiting for the rate limit, as spans below the SDK call.
+func (r *requestHandler) traceWaits(req *request, rateWaitStart, picked time.Time) {
+	lane := Attributes{"abios.lane": req.priority.String()}
+
+	_, span := r.getTracer().Start(req.ctx, spanQueueWait, req.queuedAt, lane)
+	span.End(picked)
+
+	if rateWaitStart.Before(req.queuedAt) {
+		rateWaitStart = req.queuedAt
+	}
+	_, span = r.getTracer().Start(req.ctx, spanRateLimitWait, rateWaitStart, lane)
+	span.End(picked)
+}
+
+// startHTTP starts the span of an HTTP round-trip.
+func startHTTP(t Tracer, ctx context.Context, method, endpoint string) (context.Context, Span) {
+	return t.Start(ctx, spanHTTP, time.Now(), Attributes{
+		"http.method":    method,
+		"abios.endpoint": route.Family(endpoint),
+	})
+}
+
+// endHTTP ends the span of an HTTP round-trip with the outcome in res.
+func endHTTP(span Span, res result) {
+	span.SetAttributes(Attributes{"http.status_code": res.statuscode})
+	if res.err != nil {
+		span.RecordError(res.err)
+	}
+	span.End(time.Now())
+}
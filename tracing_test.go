@@ -0,0 +1,66 @@
+package abios
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTracer is a Tracer remembering the names of the spans it started.
+type recordingTracer struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, start time.Time, attrs Attributes) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = append(r.names, name)
+	return ctx, nopSpan{}
+}
+
+func TestStartCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		endpoint string
+		want     string
+	}{
+		{"named call", withCall(context.Background(), "SeriesById"), seriesById + "12", "abios.SeriesById"},
+		{"unnamed call", context.Background(), seriesById + "12", "abios./v2/series/:id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &recordingTracer{}
+			a := &client{handler: newTestHandler()}
+			a.SetTracer(tracer)
+
+			a.startCall(tt.ctx, tt.endpoint, nil)
+			if len(tracer.names) != 1 || tracer.names[0] != tt.want {
+				t.Errorf("got spans %v, want %v", tracer.names, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTracerWhileTracing(t *testing.T) {
+	a := &client{handler: newTestHandler()}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			a.SetTracer(&recordingTracer{})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, span := a.startCall(context.Background(), seriesById+"1", nil)
+			endSpan(span)
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,396 @@
+package abios
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+	"github.com/gobuffalo/uuid"
+)
+
+// Layout of the datetimes returned by the API.
+const timeLayout = "2006-01-02T15:04:05Z"
+
+// How long after its start a series without an end is considered live. A series still
+// missing its end after that is assumed to be abandoned rather than still running.
+const max_live_duration = 24 * time.Hour
+
+// seriesPhase describes where a series is in its life cycle, which decides how often
+// it is worth refreshing.
+type seriesPhase int
+
+const (
+	phaseLive  seriesPhase = iota // Started but not ended, at most max_live_duration ago.
+	phaseSoon                     // Starts within the hour.
+	phaseToday                    // Starts within a day.
+	phaseLater                    // Starts later or hasn't been scheduled.
+	phaseOver                     // Ended, deleted or abandoned.
+)
+
+// phaseOf returns the phase of s at the given time.
+func phaseOf(s SeriesStruct, now time.Time) seriesPhase {
+	if s.DeletedAt != nil || s.End != nil {
+		return phaseOver
+	}
+	if s.Start == nil {
+		return phaseLater
+	}
+
+	start, err := time.Parse(timeLayout, *s.Start)
+	if err != nil {
+		return phaseLater
+	}
+
+	switch until := start.Sub(now); {
+	case until <= -max_live_duration:
+		return phaseOver
+	case until <= 0:
+		return phaseLive
+	case until <= time.Hour:
+		return phaseSoon
+	case until <= 24*time.Hour:
+		return phaseToday
+	default:
+		return phaseLater
+	}
+}
+
+// WatchIntervals decides how often the Watcher polls.
+type WatchIntervals struct {
+	Live     time.Duration // Series that have started but not ended.
+	Soon     time.Duration // Series starting within the hour.
+	Today    time.Duration // Series starting within a day.
+	Later    time.Duration // Series starting later.
+	Discover time.Duration // How often the series list is fetched to find new series.
+}
+
+// DefaultWatchIntervals are used for every interval left as 0.
+var DefaultWatchIntervals = WatchIntervals{
+	Live:     15 * time.Second,
+	Soon:     time.Minute,
+	Today:    10 * time.Minute,
+	Later:    time.Hour,
+	Discover: 5 * time.Minute,
+}
+
+// interval returns how long to wait before polling a series in the given phase.
+func (i WatchIntervals) interval(p seriesPhase) time.Duration {
+	switch p {
+	case phaseLive:
+		return i.Live
+	case phaseSoon:
+		return i.Soon
+	case phaseToday:
+		return i.Today
+	default:
+		return i.Later
+	}
+}
+
+// withDefaults returns i with every interval less than or equal to 0 replaced by the
+// corresponding DefaultWatchIntervals.
+func (i WatchIntervals) withDefaults() WatchIntervals {
+	if i.Live <= 0 {
+		i.Live = DefaultWatchIntervals.Live
+	}
+	if i.Soon <= 0 {
+		i.Soon = DefaultWatchIntervals.Soon
+	}
+	if i.Today <= 0 {
+		i.Today = DefaultWatchIntervals.Today
+	}
+	if i.Later <= 0 {
+		i.Later = DefaultWatchIntervals.Later
+	}
+	if i.Discover <= 0 {
+		i.Discover = DefaultWatchIntervals.Discover
+	}
+	return i
+}
+
+// watched is a series tracked by the Watcher.
+type watched struct {
+	snapshot SeriesStruct
+	next     time.Time // When the series is polled next.
+}
+
+// Watcher polls the /series endpoint and emits changes as SeriesMessages with the same
+// Diff and Events as the push API sends, so consumers can use either transport. It is
+// meant for accounts without access to the push API.
+type Watcher struct {
+	sdk       AbiosSdk
+	params    Parameters
+	intervals WatchIntervals
+	known     map[int64]*watched
+	finished  map[int64]bool // Series that are over but still listed, so not polled again.
+	listed    bool           // Whether the series list has been fetched in full, so series found since are new.
+	messages  chan SeriesMessage
+	errors    chan error
+	running   uint32 // Non-zero once Run is called, accessed atomically.
+}
+
+// NewWatcher returns a Watcher that discovers series by querying /series with params and
+// then polls each of them according to intervals.
+func NewWatcher(sdk AbiosSdk, params Parameters, intervals WatchIntervals) *Watcher {
+	intervals = intervals.withDefaults()
+
+	if params == nil {
+		params = make(Parameters)
+	}
+
+	return &Watcher{
+		sdk:       sdk,
+		params:    params,
+		intervals: intervals,
+		known:     make(map[int64]*watched),
+		finished:  make(map[int64]bool),
+		messages:  make(chan SeriesMessage, 1),
+		errors:    make(chan error, 1),
+	}
+}
+
+// Run starts polling until ctx is done. The returned channels are equivalent to the ones
+// returned by PushServiceInit: the message channel is closed once polling stops. Failed
+// requests are reported as errors unwrapping to the Err of their ErrorStruct, e.g.
+// ErrQueueFull or context.Canceled. The series listed when the Watcher starts are taken
+// as a snapshot, only the series found after that are emitted as created. A Watcher
+// runs once, calling Run again returns the same channels without polling twice.
+func (w *Watcher) Run(ctx context.Context) (chan SeriesMessage, chan error) {
+	if atomic.CompareAndSwapUint32(&w.running, 0, 1) {
+		go w.loop(ctx)
+	}
+	return w.messages, w.errors
+}
+
+// loop polls whatever is due and sleeps until something is due again. It closes the
+// message channel when ctx is done.
+func (w *Watcher) loop(ctx context.Context) {
+	defer close(w.messages)
+	var nextDiscover time.Time
+
+	for {
+		now := time.Now()
+		if !now.Before(nextDiscover) {
+			w.discover(ctx, now)
+			nextDiscover = now.Add(w.intervals.Discover)
+		}
+
+		for id, entry := range w.known {
+			if !now.Before(entry.next) {
+				w.refresh(ctx, id, now)
+			}
+		}
+
+		wake := nextDiscover
+		for _, entry := range w.known {
+			if entry.next.Before(wake) {
+				wake = entry.next
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(wake)):
+		}
+	}
+}
+
+// discover fetches every page of the series list and compares it to what we know.
+// Finished series that are no longer listed are forgotten once every page is fetched.
+// Until the list has been fetched in full once, the series found are only recorded.
+func (w *Watcher) discover(ctx context.Context, now time.Time) {
+	params := make(Parameters)
+	for k, v := range w.params {
+		params[k] = append([]string{}, v...)
+	}
+	listed := make(map[int64]bool)
+
+	for page := int64(1); ; page++ {
+		if ctx.Err() != nil {
+			return
+		}
+
+		params.Set("page", strconv.FormatInt(page, 10))
+		list, err := w.sdk.WithContext(WithPriority(ctx, PriorityBackground)).Series(params)
+		if err != nil {
+			w.report(fmt.Errorf("listing series: %w", &requestError{err: err}))
+			return
+		}
+
+		for _, s := range list.Data {
+			listed[s.Id] = true
+			w.update(ctx, s, now, !w.listed)
+		}
+
+		if list.LastPage <= page {
+			break
+		}
+	}
+
+	for id := range w.finished {
+		if !listed[id] {
+			delete(w.finished, id)
+		}
+	}
+	w.listed = true
+}
+
+// refresh polls a single series.
+func (w *Watcher) refresh(ctx context.Context, id int64, now time.Time) {
+	lane := PriorityBackground
+	if phaseOf(w.known[id].snapshot, now) == phaseLive {
+		lane = PriorityLive
+	}
+
+	s, err := w.sdk.WithContext(WithPriority(ctx, lane)).SeriesById(int(id), nil)
+	if err != nil {
+		w.report(fmt.Errorf("refreshing series %d: %w", id, &requestError{err: err}))
+		w.known[id].next = now.Add(w.intervals.interval(phaseOf(w.known[id].snapshot, now)))
+		return
+	}
+	w.update(ctx, s, now, false)
+}
+
+// update compares s to the previous snapshot, emits a message if anything changed and
+// schedules the next poll. A series seen for the first time is only recorded if
+// snapshot is set.
+func (w *Watcher) update(ctx context.Context, s SeriesStruct, now time.Time, snapshot bool) {
+	if w.finished[s.Id] {
+		return
+	}
+	entry, ok := w.known[s.Id]
+
+	var payload SeriesPayload
+	switch {
+	case !ok && snapshot:
+	case !ok:
+		payload = SeriesPayload{Type: SeriesPayloadTypeCreated, State: s}
+	case s.DeletedAt != nil && entry.snapshot.DeletedAt == nil:
+		payload = SeriesPayload{Type: SeriesPayloadTypeDeleted, State: s}
+	default:
+		diff := diffSeries(entry.snapshot, s)
+		if len(diff) == 0 {
+			break
+		}
+		payload = SeriesPayload{
+			Type:   SeriesPayloadTypeUpdated,
+			Events: seriesEvents(entry.snapshot, s),
+			State:  s,
+			Diff:   diff,
+		}
+	}
+
+	phase := phaseOf(s, now)
+	if phase == phaseOver {
+		delete(w.known, s.Id) // Nothing more will happen, stop polling.
+		w.finished[s.Id] = true
+	} else {
+		w.known[s.Id] = &watched{snapshot: s, next: now.Add(w.intervals.interval(phase))}
+	}
+
+	if payload.Type != "" {
+		w.emit(ctx, payload, now)
+	}
+}
+
+// emit wraps payload in a SeriesMessage and sends it to the consumer.
+func (w *Watcher) emit(ctx context.Context, payload SeriesPayload, now time.Time) {
+	m := SeriesMessage{
+		Message: Message{
+			Channel: "series",
+			UUID:    uuid.Must(uuid.NewV4()),
+		},
+		CreatedTimestamp: now.Unix(),
+		Payload:          payload,
+	}
+	m.Raw, _ = json.Marshal(m)
+
+	select {
+	case w.messages <- m:
+	case <-ctx.Done():
+	}
+}
+
+// report passes err on to the consumer without blocking the polling.
+func (w *Watcher) report(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// diffSeries lists the top-level attributes that differ between two snapshots, using
+// the JSON representation of the values like the push API does.
+func diffSeries(before, after SeriesStruct) []Diff {
+	b, a := jsonFields(before), jsonFields(after)
+
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diff := []Diff{}
+	for _, k := range keys {
+		if !reflect.DeepEqual(b[k], a[k]) {
+			diff = append(diff, Diff{Attribute: k, Before: b[k], After: a[k]})
+		}
+	}
+	return diff
+}
+
+// jsonFields returns the top-level fields of v as encoded by encoding/json.
+func jsonFields(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(raw, &fields)
+	return fields
+}
+
+// seriesEvents derives the events the push API would attach to the change from before
+// to after.
+func seriesEvents(before, after SeriesStruct) []string {
+	events := []string{}
+
+	if !reflect.DeepEqual(before.Start, after.Start) {
+		events = append(events, SeriesPayloadEventMoved)
+	}
+	if !reflect.DeepEqual(before.Scores, after.Scores) {
+		events = append(events, SeriesPayloadEventScored)
+	}
+	if len(before.Matches) != len(after.Matches) {
+		events = append(events, SeriesPayloadEventMap)
+	}
+
+	winners := make(map[int64]bool)
+	for _, m := range before.Matches {
+		winners[m.Id] = m.Winner != nil
+	}
+	for _, m := range after.Matches {
+		if m.Winner != nil && !winners[m.Id] {
+			events = append(events, SeriesPayloadEventWon)
+			break
+		}
+	}
+
+	if before.End == nil && after.End != nil {
+		events = append(events, SeriesPayloadEventEnded)
+	}
+
+	return events
+}
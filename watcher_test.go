@@ -0,0 +1,268 @@
+package abios
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/PatronGG/abios-go-sdk/structs"
+)
+
+func TestSeriesEvents(t *testing.T) {
+	start, moved, end := "2024-01-01T12:00:00Z", "2024-01-01T14:00:00Z", "2024-01-01T15:00:00Z"
+	winner := int64(7)
+	base := SeriesStruct{Id: 1, Start: &start, Scores: &ScoresStruct{"7": 0}, Matches: []MatchStruct{{Id: 10}}}
+	with := func(change func(*SeriesStruct)) SeriesStruct {
+		s := base
+		change(&s)
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		after SeriesStruct
+		want  []string
+	}{
+		{"unchanged", base, []string{}},
+		{"moved", with(func(s *SeriesStruct) { s.Start = &moved }), []string{SeriesPayloadEventMoved}},
+		{"scored", with(func(s *SeriesStruct) { s.Scores = &ScoresStruct{"7": 1} }), []string{SeriesPayloadEventScored}},
+		{"new map", with(func(s *SeriesStruct) { s.Matches = []MatchStruct{{Id: 10}, {Id: 11}} }), []string{SeriesPayloadEventMap}},
+		{"map won", with(func(s *SeriesStruct) { s.Matches = []MatchStruct{{Id: 10, Winner: &winner}} }), []string{SeriesPayloadEventWon}},
+		{"ended", with(func(s *SeriesStruct) { s.End = &end }), []string{SeriesPayloadEventEnded}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := seriesEvents(base, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffSeries(t *testing.T) {
+	before := SeriesStruct{Id: 1, Title: "Final", BestOf: 3}
+	after := SeriesStruct{Id: 1, Title: "Grand Final", BestOf: 3, Streamed: true}
+
+	want := []Diff{
+		{Attribute: "streamed", Before: false, After: true},
+		{Attribute: "title", Before: "Final", After: "Grand Final"},
+	}
+	if got := diffSeries(before, after); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := diffSeries(before, before); len(got) != 0 {
+		t.Fatalf("got %+v for identical series", got)
+	}
+}
+
+func TestPhaseOf(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *string {
+		s := now.Add(d).Format(timeLayout)
+		return &s
+	}
+	end := "2026-10-18T11:00:00Z"
+
+	tests := []struct {
+		name   string
+		series SeriesStruct
+		want   seriesPhase
+	}{
+		{"unscheduled", SeriesStruct{}, phaseLater},
+		{"next week", SeriesStruct{Start: at(7 * 24 * time.Hour)}, phaseLater},
+		{"tonight", SeriesStruct{Start: at(6 * time.Hour)}, phaseToday},
+		{"soon", SeriesStruct{Start: at(30 * time.Minute)}, phaseSoon},
+		{"started", SeriesStruct{Start: at(-2 * time.Hour)}, phaseLive},
+		{"ended", SeriesStruct{Start: at(-2 * time.Hour), End: &end}, phaseOver},
+		{"never ended", SeriesStruct{Start: at(-max_live_duration - time.Minute)}, phaseOver},
+	}
+
+	for _, tt := range tests {
+		if got := phaseOf(tt.series, now); got != tt.want {
+			t.Errorf("%s: got phase %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWatcherFirstListingIsSnapshot(t *testing.T) {
+	var mu sync.Mutex
+	list := `{"last_page":1,"data":[{"id":1},{"id":2}]}`
+	a := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]byte(list))
+	}))
+	w := NewWatcher(a, nil, WatchIntervals{})
+
+	w.discover(context.Background(), time.Now())
+	select {
+	case m := <-w.messages:
+		t.Fatalf("got a %s message for series %d that existed before the watcher started", m.Payload.Type, m.Payload.State.Id)
+	default:
+	}
+
+	mu.Lock()
+	list = `{"last_page":1,"data":[{"id":1},{"id":2},{"id":3}]}`
+	mu.Unlock()
+	w.discover(context.Background(), time.Now())
+	select {
+	case m := <-w.messages:
+		if m.Payload.Type != SeriesPayloadTypeCreated || m.Payload.State.Id != 3 {
+			t.Fatalf("got a %s message for series %d, want series 3 created", m.Payload.Type, m.Payload.State.Id)
+		}
+	default:
+		t.Fatal("the new series isn't emitted")
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	var lists int32
+	a := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lists, 1)
+		w.Write([]byte(`{"last_page":1,"data":[]}`))
+	}))
+	w := NewWatcher(a, nil, WatchIntervals{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, _ := w.Run(ctx)
+	if again, _ := w.Run(ctx); again != messages {
+		t.Fatal("a second Run returned other channels")
+	}
+	for atomic.LoadInt32(&lists) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fatal("got a message from an empty list")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message channel isn't closed once ctx is done")
+	}
+	if n := atomic.LoadInt32(&lists); n != 1 {
+		t.Errorf("the series were listed %d times, want once", n)
+	}
+}
+
+// drain discards the messages of w until the test ends.
+func drain(t *testing.T, w *Watcher) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for {
+			select {
+			case _, ok := <-w.messages:
+				if !ok {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func TestWatcherForgetsFinishedSeries(t *testing.T) {
+	var mu sync.Mutex
+	list := `{"last_page":1,"data":[{"id":1,"end":"2026-10-18T10:00:00Z"},{"id":2}]}`
+	a := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]byte(list))
+	}))
+
+	w := NewWatcher(a, nil, WatchIntervals{})
+	drain(t, w)
+	now := time.Now()
+
+	w.discover(context.Background(), now)
+	if !w.finished[1] || w.known[1] != nil {
+		t.Fatalf("the ended series isn't finished: finished %v", w.finished)
+	}
+
+	mu.Lock()
+	list = `{"last_page":1,"data":[{"id":2}]}`
+	mu.Unlock()
+	w.discover(context.Background(), now)
+	if len(w.finished) != 0 {
+		t.Fatalf("finished %v after the series is no longer listed, want none", w.finished)
+	}
+	if w.known[2] == nil {
+		t.Fatal("the listed series is no longer watched")
+	}
+}
+
+func TestWatcherKeepsFinishedSeriesOnError(t *testing.T) {
+	a := newTestClient(t, respond(map[string]response{
+		"/v2/series": {200, `{"last_page":2,"data":[{"id":1,"end":"2026-10-18T10:00:00Z"}]}`},
+	}))
+	w := NewWatcher(a, nil, WatchIntervals{})
+	drain(t, w)
+	w.finished[3] = true
+
+	// The second page fails, so series 3 may still be listed and is kept.
+	a.Use(func(next Handler) Handler {
+		return func(req *Request) (*Response, error) {
+			if req.Params["page"][0] == "2" {
+				return &Response{StatusCode: 500, Body: []byte(`{"error":"Internal Server Error","error_code":500}`)}, nil
+			}
+			return next(req)
+		}
+	})
+	w.discover(context.Background(), time.Now())
+	if !w.finished[3] || !w.finished[1] {
+		t.Fatalf("finished %v after a failed listing, want 1 and 3", w.finished)
+	}
+}
+
+func TestWatcherErrors(t *testing.T) {
+	a := newTestClient(t, respond(map[string]response{
+		"/v2/series":   {503, `{"error":"Service Unavailable","error_code":503,"error_description":"down"}`},
+		"/v2/series/1": {200, `{"id":1}`},
+	}))
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		poll     func(w *Watcher)
+		wantCode int64
+		wantErr  error // What the error unwraps to, if anything.
+	}{
+		{"listing", func(w *Watcher) { w.discover(context.Background(), time.Now()) }, 503, nil},
+		{"refreshing cancelled", func(w *Watcher) { w.refresh(cancelled, 1, time.Now()) }, 0, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWatcher(a, nil, WatchIntervals{})
+			w.known[1] = &watched{snapshot: SeriesStruct{Id: 1}}
+			tt.poll(w)
+
+			var err error
+			select {
+			case err = <-w.errors:
+			default:
+				t.Fatal("no error reported")
+			}
+			var rerr *requestError
+			if !errors.As(err, &rerr) {
+				t.Fatalf("%v doesn't carry the ErrorStruct", err)
+			}
+			if rerr.err.ErrorCode != tt.wantCode {
+				t.Errorf("ErrorCode = %d, want %d", rerr.err.ErrorCode, tt.wantCode)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("%v doesn't unwrap to %v", err, tt.wantErr)
+			}
+		})
+	}
+}